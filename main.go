@@ -5,32 +5,67 @@ import (
 	"b1Exchange/pkg/conf"
 	"b1Exchange/pkg/exchange"
 	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/server"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
-	var cfgPath string
+	var (
+		cfgPath    string
+		dumpConfig bool
+	)
 	flag.StringVar(&cfgPath, "config", "conf/b1.yaml", "configuration file")
+	flag.BoolVar(&dumpConfig, "dump-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [validate-config]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	if flag.NArg() > 1 || (flag.NArg() == 1 && flag.Arg(0) != "validate-config") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	cfg, err := conf.Parse(cfgPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 
+	// 只检查配置，所有问题在Parse时一次输出
+	if flag.Arg(0) == "validate-config" {
+		fmt.Printf("配置文件 %s 检查通过\n", cfgPath)
+		return
+	}
+
+	if dumpConfig {
+		data, err := conf.Dump(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	log.Init(cfg.LogFile, cfg.LogLevel)
+	log.SetSecrets(cfg.Secrets()...)
+	log.InitAudit(cfg.AuditLogFile)
 
 	var (
-		ex *exchange.Exchange
+		cluster *exchange.Cluster
 	)
 
 	for {
-		ex, err = exchange.NewExchange(cfg)
+		cluster, err = exchange.NewCluster(cfg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "创建交易客户端失败, %s\n", err)
 			fmt.Fprintf(os.Stderr, "等待%d毫秒再次尝试\n", cfg.CreateExchangeClientWaitTime)
@@ -42,11 +77,31 @@ func main() {
 		}
 	}
 
-	ex.Start()
+	cluster.Start()
 
-	http.Handle("/info", ex)
+	// 收到SIGHUP信号时重新加载配置
+	go func() {
+		var c = make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for range c {
+			log.Logger.Infof("收到SIGHUP信号，重新加载配置")
+			cluster.Reload("signal")
+		}
+	}()
+
+	http.Handle("/info", cluster)
+	http.HandleFunc("/share", cluster.ServeShare)
+	http.HandleFunc("/share.csv", cluster.ServeShareCSV)
+	http.HandleFunc("/pnl", cluster.ServePnl)
+	http.HandleFunc("/api/v1/status", cluster.ServeStatus)
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/api/v1/control/", cluster.ServeControl)
 
-	if err = http.ListenAndServe("0.0.0.0:18080", nil); err != nil {
+	if err = server.Serve(cfg.HTTP, http.DefaultServeMux); err != nil {
 		log.Logger.Errorf("%s\n", err)
+		return
 	}
+
+	// http服务禁用时继续运行交易
+	select {}
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"b1Exchange/pkg/model"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -21,24 +22,49 @@ type Client struct {
 	endPoint  string
 	appKey    string
 	appSecret []byte
+	base      string
 
 	httpClient *http.Client
+	limiter    *rateLimiter
+	breaker    *circuitBreaker
+	metrics    *metricsTransport
 }
 
-// 创建b1的api客户端
-func NewClient(ep, key, secret string, timeout int64) *Client {
+// 创建b1的api客户端, rate为每秒最大请求数，为0时不限速
+func NewClient(ep, key, secret string, timeout int64, rate int) *Client {
 	var tp = &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
+	var limiter *rateLimiter
+	if rate > 0 {
+		limiter = newRateLimiter(rate)
+	}
+
+	var base string
+	if u, err := url.Parse(ep); err == nil {
+		base = u.Path
+	}
+
+	var mt = &metricsTransport{base: base, next: tp}
 	return &Client{
 		endPoint:  ep,
 		appKey:    key,
 		appSecret: []byte(secret),
+		base:      base,
 		httpClient: &http.Client{
-			Transport: tp,
+			Transport: mt,
 			Timeout:   time.Duration(timeout) * time.Millisecond,
 		},
+		limiter: limiter,
+		metrics: mt,
+	}
+}
+
+// 请求限速
+func (p *Client) wait() {
+	if p.limiter != nil {
+		p.limiter.Wait()
 	}
 }
 
@@ -47,6 +73,7 @@ func NewClient(ep, key, secret string, timeout int64) *Client {
 //   "timestamp": 1527665262168391000
 // }
 func (p *Client) Ping() (ts int64, err error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/%s", p.endPoint, "ping"))
 	if err != nil {
 		return -1, err
@@ -70,6 +97,7 @@ func (p *Client) Ping() (ts int64, err error) {
 
 // 获取所有的市场，即交易对
 func (p *Client) GetAllMarkets() (*model.MarketResponeBody, error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/%s", p.endPoint, "markets"))
 	if err != nil {
 		return nil, err
@@ -99,6 +127,7 @@ func (p *Client) GetAllMarkets() (*model.MarketResponeBody, error) {
 // 由于bigone支持较多的交易对，一次获取所有行情数据比较多
 // GET /tickers
 func (p *Client) GetAllTickers() (*model.AllTickersResponeBody, error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/%s", p.endPoint, "tickers"))
 	if err != nil {
 		return nil, err
@@ -127,6 +156,7 @@ func (p *Client) GetAllTickers() (*model.AllTickersResponeBody, error) {
 // GET /markets/{market_id}/ticker
 // market_id: ETH-BTC
 func (p *Client) GetTicker(id string) (*model.MarketTickerResponeBody, error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/markets/%s/%s", p.endPoint, id, "ticker"))
 	if err != nil {
 		return nil, err
@@ -167,6 +197,7 @@ func (p *Client) JWTSignature(nonce int64) (string, error) {
 // 获取账户资产信息
 // GET /viewer/accounts
 func (p *Client) GetAccounts(nonce int64) (*model.AccountResponeBody, error) {
+	p.wait()
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", p.endPoint, "viewer/accounts"), nil)
 	if err != nil {
 		return nil, err
@@ -211,6 +242,7 @@ func (p *Client) GetAccounts(nonce int64) (*model.AccountResponeBody, error) {
 // side order side one of "ASK"/"BID" false
 // state order state one of "CANCELED"/"FILLED"/"PENDING" false
 func (p *Client) GetOrders(nonce int64, parms map[string]string) (*model.OrderListResponeBody, error) {
+	p.wait()
 	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s", p.endPoint, "viewer/orders"))
 	if err != nil {
 		return nil, err
@@ -256,8 +288,28 @@ func (p *Client) GetOrders(nonce int64, parms map[string]string) (*model.OrderLi
 	return body, nil
 }
 
+// 请求已经发出但没有收到有效响应的错误，如连接中断、请求超时或响应无法解析，
+// 请求可能已经被交易所处理
+type UncertainError struct {
+	Err error
+}
+
+func (p *UncertainError) Error() string {
+	return p.Err.Error()
+}
+
+// 是否为请求结果未知的错误，熔断时请求没有发出，不属于结果未知
+func IsUncertain(err error) bool {
+	var (
+		uncertain *UncertainError
+		open      *CircuitOpenError
+	)
+	return errors.As(err, &uncertain) && !errors.As(err, &open)
+}
+
 // POST /viewer/orders
 func (p *Client) CreateOrder(nonce int64, parms map[string]string) (*model.Order, error) {
+	p.wait()
 	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s", p.endPoint, "viewer/orders"))
 	if err != nil {
 		return nil, err
@@ -279,6 +331,49 @@ func (p *Client) CreateOrder(nonce int64, parms map[string]string) (*model.Order
 	}
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
 
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, &UncertainError{Err: err}
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &UncertainError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	var body = new(model.OrderResponeBody)
+	err = json.Unmarshal(data, body)
+	if err != nil {
+		return nil, &UncertainError{Err: fmt.Errorf("unmarshal failed. data: %s", string(data))}
+	}
+
+	if len(body.Errors) != 0 {
+		return nil, fmt.Errorf("create order respone have errors. data: %s", string(data))
+	}
+
+	return body.Data, nil
+}
+
+// GET /viewer/orders/{order_id}
+func (p *Client) GetOrder(nonce int64, id string) (*model.Order, error) {
+	p.wait()
+	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s/%s", p.endPoint, "viewer/orders", id))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", reqUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.JWTSignature(nonce)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -297,7 +392,7 @@ func (p *Client) CreateOrder(nonce int64, parms map[string]string) (*model.Order
 	}
 
 	if len(body.Errors) != 0 {
-		return nil, fmt.Errorf("create order respone have errors. data: %s", string(data))
+		return nil, fmt.Errorf("get order respone have errors. data: %s", string(data))
 	}
 
 	return body.Data, nil
@@ -305,6 +400,7 @@ func (p *Client) CreateOrder(nonce int64, parms map[string]string) (*model.Order
 
 // POST /viewer/orders/{order_id}/cancel
 func (p *Client) CancelOrder(nonce int64, id string) (*model.Order, error) {
+	p.wait()
 	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s/%s/cancel", p.endPoint, "viewer/orders", id))
 	if err != nil {
 		return nil, err
@@ -347,6 +443,7 @@ func (p *Client) CancelOrder(nonce int64, id string) (*model.Order, error) {
 
 // POST /viewer/orders/cancel_all
 func (p *Client) CancelAllOrders(nonce int64, market string) error {
+	p.wait()
 	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s/cancel_all", p.endPoint, "viewer/orders"))
 	if err != nil {
 		return err
@@ -377,12 +474,16 @@ func (p *Client) CancelAllOrders(nonce int64, market string) error {
 	}
 	defer resp.Body.Close()
 
-	var body = new(model.Order)
+	var body = new(model.CancelAllOrdersResponeBody)
 	err = json.Unmarshal(data, body)
 	if err != nil {
 		return fmt.Errorf("unmarshal failed. data: %s", string(data))
 	}
 
+	if len(body.Errors) != 0 {
+		return fmt.Errorf("cancel all orders result have errors. data: %s", string(data))
+	}
+
 	return nil
 }
 
@@ -394,6 +495,7 @@ func (p *Client) CancelAllOrders(nonce int64, market string) error {
 //   "data": 80000000
 // }
 func (p *Client) OneHourlyStatistic() (*model.OneHourlyLimitationResponeBody, error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/%s", p.endPoint, "one"))
 	if err != nil {
 		return nil, err
@@ -419,6 +521,7 @@ func (p *Client) OneHourlyStatistic() (*model.OneHourlyLimitationResponeBody, er
 }
 
 func (p *Client) OneLimitation() (*model.OneLimitationResponeBody, error) {
+	p.wait()
 	resp, err := p.httpClient.Get(fmt.Sprintf("%s/%s", p.endPoint, "one/limitation"))
 	if err != nil {
 		return nil, err
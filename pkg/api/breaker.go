@@ -0,0 +1,295 @@
+package api
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/model"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 熔断状态
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half_open"
+	CircuitOpen     = "open"
+)
+
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitHalfOpen: 1,
+	CircuitOpen:     2,
+}
+
+// 熔断打开时请求直接返回的错误
+type CircuitOpenError struct {
+	Endpoint string
+	Until    time.Time
+}
+
+func (p *CircuitOpenError) Error() string {
+	return fmt.Sprintf("api %s 已熔断, %s 后重试", p.Endpoint, p.Until.Format("15:04:05"))
+}
+
+// 请求结果
+type circuitEvent struct {
+	time time.Time
+	ok   bool
+}
+
+// 单个接口的熔断状态
+type circuit struct {
+	state       string
+	consecutive int
+	events      []circuitEvent
+	openedAt    time.Time
+	probes      int // 半开状态下正在进行的探测请求数
+}
+
+// 熔断状态
+type CircuitStatus struct {
+	Endpoint            string    `json:"endpoint"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Requests            int       `json:"requests"`
+	Failures            int       `json:"failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+}
+
+// 按接口统计连续失败次数和时间窗口内的失败比例，超过限制时打开熔断，
+// 打开期间请求直接返回错误，open_time后进入半开状态，允许half_open_probes个探测请求，
+// 探测成功时关闭熔断，失败时重新打开
+type circuitBreaker struct {
+	sync.Mutex
+	name     string
+	base     string
+	config   *model.CircuitBreakerConfig
+	circuits map[string]*circuit
+	next     http.RoundTripper
+}
+
+func newCircuitBreaker(name, base string, cfg *model.CircuitBreakerConfig, next http.RoundTripper) *circuitBreaker {
+	return &circuitBreaker{
+		name:     name,
+		base:     base,
+		config:   cfg,
+		circuits: make(map[string]*circuit),
+		next:     next,
+	}
+}
+
+// 只有请求失败、服务器错误和请求过多时认为接口异常，其他错误由调用方处理
+func requestFailed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
+
+func (p *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := metrics.Endpoint(p.base, req.URL.Path)
+	if err := p.allow(endpoint, time.Now()); err != nil {
+		metrics.APIRequests.WithLabelValues(p.name, endpoint, "circuit_open").Inc()
+		return nil, err
+	}
+
+	resp, err := p.next.RoundTrip(req)
+	p.record(endpoint, !requestFailed(resp, err), time.Now())
+	return resp, err
+}
+
+func (p *circuitBreaker) get(endpoint string) *circuit {
+	c, ok := p.circuits[endpoint]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		p.circuits[endpoint] = c
+	}
+	return c
+}
+
+func (p *circuitBreaker) setState(endpoint string, c *circuit, state string) {
+	c.state = state
+	metrics.CircuitState.WithLabelValues(p.name, endpoint).Set(circuitStateValues[state])
+}
+
+// 检查是否允许请求
+func (p *circuitBreaker) allow(endpoint string, now time.Time) error {
+	p.Lock()
+	defer p.Unlock()
+
+	var (
+		c        = p.get(endpoint)
+		openTime = time.Duration(p.config.OpenTime) * time.Millisecond
+	)
+
+	if c.state == CircuitOpen {
+		if now.Sub(c.openedAt) < openTime {
+			return &CircuitOpenError{Endpoint: endpoint, Until: c.openedAt.Add(openTime)}
+		}
+		log.Logger.Infof("api %s/%s 熔断进入半开状态", p.name, endpoint)
+		p.setState(endpoint, c, CircuitHalfOpen)
+		c.probes = 0
+	}
+
+	if c.state == CircuitHalfOpen {
+		if c.probes >= p.config.HalfOpenProbes {
+			return &CircuitOpenError{Endpoint: endpoint, Until: now.Add(time.Second)}
+		}
+		c.probes++
+	}
+
+	return nil
+}
+
+// 记录请求结果
+func (p *circuitBreaker) record(endpoint string, ok bool, now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	var c = p.get(endpoint)
+	switch c.state {
+	case CircuitOpen:
+		// 熔断打开前发出的请求
+		return
+	case CircuitHalfOpen:
+		if c.probes > 0 {
+			c.probes--
+		}
+		if ok {
+			log.Logger.Infof("api %s/%s 探测请求成功, 关闭熔断", p.name, endpoint)
+			p.setState(endpoint, c, CircuitClosed)
+			c.consecutive = 0
+			c.events = nil
+		} else {
+			p.open(endpoint, c, now, "探测请求失败")
+		}
+		return
+	}
+
+	var window = time.Duration(p.config.Window) * time.Millisecond
+	c.events = append(c.events, circuitEvent{time: now, ok: ok})
+	var i int
+	for i < len(c.events) && now.Sub(c.events[i].time) > window {
+		i++
+	}
+	c.events = c.events[i:]
+
+	if ok {
+		c.consecutive = 0
+		return
+	}
+	c.consecutive++
+
+	if c.consecutive >= p.config.ConsecutiveFailures {
+		p.open(endpoint, c, now, fmt.Sprintf("连续失败%d次", c.consecutive))
+		return
+	}
+
+	failures := countFailures(c.events)
+	if len(c.events) >= p.config.MinRequests &&
+		float64(failures)*100/float64(len(c.events)) >= p.config.FailureRate {
+		p.open(endpoint, c, now, fmt.Sprintf("%d毫秒内%d个请求中失败%d个", p.config.Window, len(c.events), failures))
+	}
+}
+
+func (p *circuitBreaker) open(endpoint string, c *circuit, now time.Time, reason string) {
+	log.Logger.Errorf("api %s/%s %s, 打开熔断%d毫秒", p.name, endpoint, reason, p.config.OpenTime)
+	p.setState(endpoint, c, CircuitOpen)
+	c.openedAt = now
+	c.probes = 0
+}
+
+func countFailures(events []circuitEvent) int {
+	var n int
+	for _, e := range events {
+		if !e.ok {
+			n++
+		}
+	}
+	return n
+}
+
+// 处于打开状态的接口
+func (p *circuitBreaker) opened(now time.Time) []string {
+	p.Lock()
+	defer p.Unlock()
+
+	var (
+		endpoints []string
+		openTime  = time.Duration(p.config.OpenTime) * time.Millisecond
+	)
+	for endpoint, c := range p.circuits {
+		if c.state == CircuitOpen && now.Sub(c.openedAt) < openTime {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+func (p *circuitBreaker) Status() []*CircuitStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	var (
+		status = make([]*CircuitStatus, 0, len(p.circuits))
+		now    = time.Now()
+		window = time.Duration(p.config.Window) * time.Millisecond
+	)
+
+	for endpoint, c := range p.circuits {
+		var s = &CircuitStatus{
+			Endpoint:            endpoint,
+			State:               c.state,
+			ConsecutiveFailures: c.consecutive,
+		}
+		for _, e := range c.events {
+			if now.Sub(e.time) > window {
+				continue
+			}
+			s.Requests++
+			if !e.ok {
+				s.Failures++
+			}
+		}
+		if c.state != CircuitClosed {
+			s.OpenedAt = c.openedAt
+		}
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Endpoint < status[j].Endpoint
+	})
+	return status
+}
+
+// 开启请求熔断，name用于区分不同账户的客户端，同时作为api请求数统计的account标签
+func (p *Client) SetCircuitBreaker(name string, cfg *model.CircuitBreakerConfig) {
+	p.metrics.account = name
+	if cfg == nil || cfg.Disable {
+		return
+	}
+
+	p.breaker = newCircuitBreaker(name, p.base, cfg, p.httpClient.Transport)
+	p.httpClient.Transport = p.breaker
+}
+
+// 处于熔断打开状态的接口，未开启熔断时返回空
+func (p *Client) OpenCircuits() []string {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.opened(time.Now())
+}
+
+// 各个接口的熔断状态，未开启熔断时返回空
+func (p *Client) CircuitStatus() []*CircuitStatus {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.Status()
+}
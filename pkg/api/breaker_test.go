@@ -0,0 +1,208 @@
+package api
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	log.Logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// 按顺序返回预设结果的RoundTripper，status为0时返回错误
+type stubTransport struct {
+	statuses []int
+	calls    int
+}
+
+func (p *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := p.statuses[p.calls]
+	p.calls++
+	if status == 0 {
+		return nil, errors.New("connection reset")
+	}
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+const testEndpoint = "viewer/orders"
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	var (
+		cfg = &model.CircuitBreakerConfig{ConsecutiveFailures: 3, Window: 10000, FailureRate: 100, MinRequests: 100,
+			OpenTime: 1000, HalfOpenProbes: 1}
+		p   = newCircuitBreaker("test", "", cfg, nil)
+		now = time.Now()
+	)
+
+	// 成功的请求重新计数
+	for i, ok := range []bool{false, false, true, false, false} {
+		p.record(testEndpoint, ok, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if err := p.allow(testEndpoint, now); err != nil {
+		t.Fatalf("连续失败2次不应熔断. %s", err)
+	}
+
+	p.record(testEndpoint, false, now)
+	err := p.allow(testEndpoint, now.Add(500*time.Millisecond))
+	openErr, ok := err.(*CircuitOpenError)
+	if !ok || openErr.Endpoint != testEndpoint || !openErr.Until.Equal(now.Add(time.Second)) {
+		t.Fatalf("连续失败3次应熔断到 %v, 返回 %v", now.Add(time.Second), err)
+	}
+
+	if opened := p.opened(now.Add(500 * time.Millisecond)); !reflect.DeepEqual(opened, []string{testEndpoint}) {
+		t.Errorf("熔断中的接口 %v, 应为 %s", opened, testEndpoint)
+	}
+	if opened := p.opened(now.Add(time.Second)); len(opened) != 0 {
+		t.Errorf("open_time后熔断中的接口 %v, 应为空", opened)
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	var (
+		cfg = &model.CircuitBreakerConfig{ConsecutiveFailures: 100, Window: 1000, FailureRate: 50, MinRequests: 4,
+			OpenTime: 1000, HalfOpenProbes: 1}
+		now = time.Now()
+	)
+
+	for _, c := range []struct {
+		name    string
+		results []bool
+		after   []time.Duration
+		opened  bool
+	}{
+		{
+			name:    "below min requests",
+			results: []bool{false, true, false},
+			after:   []time.Duration{0, 10, 20},
+		},
+		{
+			name:    "below failure rate",
+			results: []bool{false, true, true, true, false, true, true},
+			after:   []time.Duration{0, 10, 20, 30, 40, 50, 60},
+		},
+		{
+			name:    "reach failure rate",
+			results: []bool{true, false, true, false},
+			after:   []time.Duration{0, 10, 20, 30},
+			opened:  true,
+		},
+		{
+			// 超出时间窗口的请求不计入失败比例
+			name:    "outside window",
+			results: []bool{false, false, true, true, false, true, true},
+			after:   []time.Duration{0, 10, 1100, 1110, 1120, 1130, 1140},
+		},
+	} {
+		p := newCircuitBreaker("test", "", cfg, nil)
+		for i, ok := range c.results {
+			p.record(testEndpoint, ok, now.Add(c.after[i]*time.Millisecond))
+		}
+
+		last := now.Add(c.after[len(c.after)-1] * time.Millisecond)
+		if err := p.allow(testEndpoint, last); (err != nil) != c.opened {
+			t.Errorf("%s: 检查结果 %v, 熔断应为 %v", c.name, err, c.opened)
+		}
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	var (
+		cfg = &model.CircuitBreakerConfig{ConsecutiveFailures: 1, Window: 10000, FailureRate: 100, MinRequests: 100,
+			OpenTime: 1000, HalfOpenProbes: 2}
+		p   = newCircuitBreaker("test", "", cfg, nil)
+		now = time.Now()
+	)
+
+	p.record(testEndpoint, false, now)
+	if err := p.allow(testEndpoint, now.Add(999*time.Millisecond)); err == nil {
+		t.Fatalf("open_time内应禁止请求")
+	}
+
+	// open_time后进入半开状态，只允许half_open_probes个探测请求
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := p.allow(testEndpoint, now); err != nil {
+			t.Fatalf("第%d个探测请求应允许. %s", i+1, err)
+		}
+	}
+	if err := p.allow(testEndpoint, now); err == nil {
+		t.Fatalf("超过half_open_probes的请求应禁止")
+	}
+	if s := p.Status(); len(s) != 1 || s[0].State != CircuitHalfOpen {
+		t.Errorf("熔断状态 %+v, 应为半开", s[0])
+	}
+
+	// 探测失败时重新打开
+	p.record(testEndpoint, false, now)
+	if err := p.allow(testEndpoint, now.Add(500*time.Millisecond)); err == nil {
+		t.Fatalf("探测失败后应重新熔断")
+	}
+	// 重新打开前发出的探测请求结果不改变状态
+	p.record(testEndpoint, true, now.Add(500*time.Millisecond))
+	if s := p.Status(); s[0].State != CircuitOpen {
+		t.Errorf("熔断状态 %s, 应为打开", s[0].State)
+	}
+
+	// 探测成功时关闭熔断，重新统计
+	now = now.Add(time.Second)
+	if err := p.allow(testEndpoint, now); err != nil {
+		t.Fatalf("重新打开open_time后应允许探测请求. %s", err)
+	}
+	p.record(testEndpoint, true, now)
+	for i := 0; i < 3; i++ {
+		if err := p.allow(testEndpoint, now); err != nil {
+			t.Fatalf("关闭熔断后应允许请求. %s", err)
+		}
+	}
+	if s := p.Status(); s[0].State != CircuitClosed || s[0].ConsecutiveFailures != 0 || s[0].Requests != 0 {
+		t.Errorf("关闭熔断后状态 %+v, 应重新统计", s[0])
+	}
+}
+
+func TestBreakerRoundTrip(t *testing.T) {
+	var (
+		cfg = &model.CircuitBreakerConfig{ConsecutiveFailures: 2, Window: 10000, FailureRate: 100, MinRequests: 100,
+			OpenTime: 60000, HalfOpenProbes: 1}
+		// 只有请求失败、服务器错误和请求过多时认为接口异常
+		next = &stubTransport{statuses: []int{http.StatusInternalServerError, http.StatusBadRequest,
+			http.StatusTooManyRequests, 0, http.StatusOK}}
+		p = newCircuitBreaker("test", "/api/v3", cfg, next)
+	)
+
+	request := func(path string) error {
+		req, _ := http.NewRequest(http.MethodGet, "https://big.one/api/v3/"+path, nil)
+		resp, err := p.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := request("viewer/orders/123"); err != nil && i != 3 {
+			t.Fatalf("第%d个请求返回错误. %s", i+1, err)
+		}
+	}
+
+	err := request("viewer/orders/456")
+	if openErr, ok := err.(*CircuitOpenError); !ok || openErr.Endpoint != "viewer/orders/:id" {
+		t.Fatalf("连续失败2次后应熔断, 返回 %v", err)
+	}
+	if next.calls != 4 {
+		t.Errorf("熔断时不应发出请求, 共发出 %d 个请求", next.calls)
+	}
+
+	// 其他接口不受影响
+	if err = request("viewer/accounts"); err != nil || next.calls != 5 {
+		t.Errorf("其他接口的请求返回 %v", err)
+	}
+}
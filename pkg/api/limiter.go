@@ -0,0 +1,34 @@
+package api
+
+import (
+	"time"
+)
+
+// 请求限速器，每秒最多发出rate个请求，所有使用同一个客户端的市场共享
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	var p = &rateLimiter{
+		tokens: make(chan struct{}, rate),
+	}
+
+	go func() {
+		tk := time.NewTicker(time.Second / time.Duration(rate))
+		defer tk.Stop()
+		for range tk.C {
+			select {
+			case p.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return p
+}
+
+// 等待直到可以发出请求
+func (p *rateLimiter) Wait() {
+	<-p.tokens
+}
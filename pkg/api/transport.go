@@ -0,0 +1,26 @@
+package api
+
+import (
+	"b1Exchange/pkg/metrics"
+	"fmt"
+	"net/http"
+)
+
+// 统计api请求数的http transport
+type metricsTransport struct {
+	account string
+	base    string
+	next    http.RoundTripper
+}
+
+func (p *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := metrics.Endpoint(p.base, req.URL.Path)
+	resp, err := p.next.RoundTrip(req)
+	if err != nil {
+		metrics.APIRequests.WithLabelValues(p.account, endpoint, "error").Inc()
+		return resp, err
+	}
+
+	metrics.APIRequests.WithLabelValues(p.account, endpoint, fmt.Sprintf("%d", resp.StatusCode)).Inc()
+	return resp, nil
+}
@@ -3,11 +3,13 @@ package conf
 import (
 	"b1Exchange/pkg/model"
 	"io/ioutil"
+	"os"
+	"reflect"
 
 	"gopkg.in/yaml.v2"
 )
 
-//
+// 读取配置文件，依次使用密钥文件和环境变量覆盖配置后检查配置
 func Parse(file string) (*model.Configuration, error) {
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
@@ -20,6 +22,27 @@ func Parse(file string) (*model.Configuration, error) {
 		return nil, err
 	}
 
+	secretsFile := cfg.SecretsFile
+	if v, ok := os.LookupEnv(EnvPrefix + "_" + envName("secrets_file")); ok {
+		secretsFile = v
+	}
+
+	if secretsFile != "" {
+		s, err := loadSecrets(secretsFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	err = applyEnv(EnvPrefix, reflect.ValueOf(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ConfigFile = file
 	err = cfg.Check()
 	if err != nil {
 		return nil, err
@@ -27,3 +50,8 @@ func Parse(file string) (*model.Configuration, error) {
 
 	return cfg, nil
 }
+
+// 输出隐藏密钥后的配置
+func Dump(cfg *model.Configuration) ([]byte, error) {
+	return yaml.Marshal(cfg.Redacted())
+}
@@ -0,0 +1,149 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 环境变量前缀，环境变量名为前缀加上大写的yaml配置项，例如 B1_APPKEY、B1_EXCHANGE_AMOUNT
+// 嵌套配置使用下划线连接，例如 B1_HTTP_SERVER_TOKEN
+// 账户和交易市场使用名称或交易对区分，例如 B1_ACCOUNTS_ALICE_APPSECRET、B1_MARKETS_ONE_USDT_EXCHANGE_AMOUNT
+const EnvPrefix = "B1"
+
+// 将yaml配置项名称转换为环境变量名称
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// 是否存在指定前缀的环境变量
+func hasEnvPrefix(prefix string) bool {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// 使用环境变量覆盖配置，v必须为结构体指针
+func applyEnv(prefix string, v reflect.Value) error {
+	var (
+		elem = v.Elem()
+		typ  = elem.Type()
+	)
+
+	for i := 0; i < elem.NumField(); i++ {
+		key := typ.Field(i).Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		var (
+			name  = prefix + "_" + envName(key)
+			field = elem.Field(i)
+		)
+
+		switch {
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+			if field.IsNil() {
+				if !hasEnvPrefix(name) {
+					continue
+				}
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			if err := applyEnv(name, field); err != nil {
+				return err
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Ptr:
+			for j := 0; j < field.Len(); j++ {
+				item := field.Index(j)
+				if item.IsNil() {
+					continue
+				}
+				if err := applyEnv(name+"_"+envName(itemName(item)), item); err != nil {
+					return err
+				}
+			}
+		default:
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := setField(field, value); err != nil {
+				return fmt.Errorf("环境变量 %s 格式错误. %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 账户使用name区分，交易市场使用symbol_pair区分
+func itemName(item reflect.Value) string {
+	for _, key := range []string{"Name", "SymbolPair"} {
+		if f := item.Elem().FieldByName(key); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("不支持的类型 %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持的类型 %s", field.Type())
+	}
+
+	return nil
+}
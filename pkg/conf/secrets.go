@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"b1Exchange/pkg/model"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 密钥文件，与b1.yaml分开保存，只允许所有者读写
+type secrets struct {
+	AppKey       string                     `yaml:"appkey"`
+	AppSecret    string                     `yaml:"appsecret"`
+	ControlToken string                     `yaml:"control_token"`
+	HTTPPassword string                     `yaml:"http_password"`
+	HTTPToken    string                     `yaml:"http_token"`
+	Accounts     map[string]*accountSecrets `yaml:"accounts"`
+}
+
+// 账户密钥，按账户名称匹配accounts中的账户
+type accountSecrets struct {
+	AppKey    string `yaml:"appkey"`
+	AppSecret string `yaml:"appsecret"`
+}
+
+// 读取密钥文件，文件权限对其他用户开放时拒绝加载
+func loadSecrets(file string) (*secrets, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("密钥文件 %s 权限 %#o 过于宽松，只允许所有者读写(0600)", file, perm)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var s = new(secrets)
+	if err = yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, fmt.Errorf("解析密钥文件 %s 失败. %s", file, err)
+	}
+
+	return s, nil
+}
+
+// 使用密钥文件中非空的值覆盖配置
+func (s *secrets) apply(cfg *model.Configuration) error {
+	override(&cfg.AppKey, s.AppKey)
+	override(&cfg.AppSecret, s.AppSecret)
+	override(&cfg.ControlToken, s.ControlToken)
+
+	if s.HTTPPassword != "" || s.HTTPToken != "" {
+		if cfg.HTTP == nil {
+			cfg.HTTP = new(model.HTTPConfig)
+		}
+		override(&cfg.HTTP.Password, s.HTTPPassword)
+		override(&cfg.HTTP.Token, s.HTTPToken)
+	}
+
+	for name, as := range s.Accounts {
+		var found bool
+		for _, a := range cfg.Accounts {
+			if a.Name == name {
+				override(&a.AppKey, as.AppKey)
+				override(&a.AppSecret, as.AppSecret)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("密钥文件中的账户 %s 不在accounts中", name)
+		}
+	}
+
+	return nil
+}
+
+func override(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
@@ -0,0 +1,192 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 超时订单
+type staleOrder struct {
+	order    *model.Order
+	age      int64   // 订单创建时间与服务器时间差，单位毫秒
+	distance float64 // 订单价格离买一卖一价的距离比例，越大越远
+}
+
+// 订单价格离同方向买一卖一价的距离，买单低于买一价、卖单高于卖一价时为正
+func (p *Exchange) orderDistance(order *model.Order) float64 {
+	price, err := strconv.ParseFloat(order.Price, 10)
+	if err != nil {
+		return 0
+	}
+
+	p.RLock()
+	bid, ask := p.bidPrice, p.askPrice
+	p.RUnlock()
+
+	if strings.ToUpper(order.Side) == BidOrderTypeName {
+		if bid <= 0 {
+			return 0
+		}
+		return (bid - price) / bid
+	}
+
+	if ask <= 0 {
+		return 0
+	}
+	return (price - ask) / ask
+}
+
+// 已成交数量占订单数量的百分比
+func filledPercent(order *model.Order) float64 {
+	amount, err := strconv.ParseFloat(order.Amount, 10)
+	if err != nil || amount <= 0 {
+		return 0
+	}
+	filled, _ := strconv.ParseFloat(order.FilledAmount, 10)
+	return filled * 100 / amount
+}
+
+// 订单是否在deny_ids中或数量在deny_amounts中，返回保护原因，受保护的订单永远不会被取消
+func protectedOrder(policy *model.CancelPolicyConfig, order *model.Order) string {
+	for _, id := range policy.DenyIds {
+		if id == order.Id {
+			return "在deny_ids中"
+		}
+	}
+
+	amount := normalizeNumber(order.Amount)
+	for _, v := range policy.DenyAmounts {
+		if normalizeNumber(v) == amount {
+			return fmt.Sprintf("数量 %s 在deny_amounts中", order.Amount)
+		}
+	}
+
+	return ""
+}
+
+// 是否为机器人创建的订单，allow_ids中的订单也认为是机器人的订单
+func (p *Exchange) ownOrder(policy *model.CancelPolicyConfig, order *model.Order) bool {
+	for _, id := range policy.AllowIds {
+		if id == order.Id {
+			return true
+		}
+	}
+
+	if p.owned.has(order.Id) {
+		return true
+	}
+
+	return policy.MatchSignature &&
+		p.owned.signed(orderSignature(p.symbolPair.UUID, order.Side, order.Price, order.Amount))
+}
+
+// 按撤单策略选出需要取消的超时订单并排序
+func (p *Exchange) staleOrders(cfg *model.Configuration, edges []*model.Edge, serverTime int64, otype int) []*staleOrder {
+	var (
+		policy = cfg.CancelPolicy
+		stale  []*staleOrder
+	)
+
+	for _, edge := range edges {
+		var order = edge.Node
+		switch otype {
+		case BidOrderType:
+			if strings.ToUpper(order.Side) != BidOrderTypeName {
+				continue
+			}
+		case AskOrderType:
+			if strings.ToUpper(order.Side) != AskOrderTypeName {
+				continue
+			}
+		}
+
+		age := (serverTime - order.InsertedAt.UnixNano()) / 1000000
+		if math.Abs(float64(age)) <= float64(cfg.CancelOrderDiffrentTime) {
+			continue
+		}
+
+		if reason := protectedOrder(policy, order); reason != "" {
+			p.logger.Debugf("订单 %s %s，不取消", order.Id, reason)
+			continue
+		}
+
+		if policy.OwnedOnly && !p.ownOrder(policy, order) {
+			p.logger.Debugf("订单 %s 不是机器人创建的订单，不取消", order.Id)
+			continue
+		}
+
+		if policy.MaxFilledPercent > 0 && filledPercent(order) > policy.MaxFilledPercent {
+			p.logger.Debugf("订单 %s 已成交 %.2f%%, 超过 %.2f%%, 不取消",
+				order.Id, filledPercent(order), policy.MaxFilledPercent)
+			continue
+		}
+
+		stale = append(stale, &staleOrder{order: order, age: age, distance: p.orderDistance(order)})
+	}
+
+	if policy.Priority == model.CancelPriorityDistance {
+		sort.SliceStable(stale, func(i, j int) bool {
+			return stale[i].distance > stale[j].distance
+		})
+	} else {
+		sort.SliceStable(stale, func(i, j int) bool {
+			return stale[i].age > stale[j].age
+		})
+	}
+
+	return stale
+}
+
+// 是否可以批量取消，只有超时订单数量达到batch_threshold、
+// 并且市场中所有挂单都需要取消时才批量取消，避免取消不应取消的订单。
+// owned_only时不批量取消，避免取消查询订单后手动下的订单
+func batchCancelable(policy *model.CancelPolicyConfig, state string, stale []*staleOrder, list *model.OrderList, otype int) bool {
+	if policy.BatchThreshold <= 0 || len(stale) < policy.BatchThreshold || policy.OwnedOnly {
+		return false
+	}
+
+	if state != model.OrderPendingState || otype != AllOrderType {
+		return false
+	}
+
+	if list.PageInfo != nil && list.PageInfo.HasNextPage {
+		return false
+	}
+
+	return len(stale) == len(list.Edges)
+}
+
+// 取消超时订单，每次取消后等待cancel_order_interval
+func (p *Exchange) cancelStale(cfg *model.Configuration, state string, orders *model.OrderList, serverTime int64, otype int, tk *time.Ticker) {
+	var stale = p.staleOrders(cfg, orders.Edges, serverTime, otype)
+	if len(stale) == 0 {
+		return
+	}
+
+	if batchCancelable(cfg.CancelPolicy, state, stale, orders, otype) {
+		p.logger.Infof("超时订单 %d 个, 批量取消", len(stale))
+		err := p.b1client.CancelAllOrders(time.Now().UnixNano(), p.symbolPair.UUID)
+		if err == nil {
+			for _, s := range stale {
+				p.countCancel(strings.ToUpper(s.order.Side), nil)
+			}
+			return
+		}
+		p.logger.Infof("批量取消订单失败，逐个取消. %s", err)
+	}
+
+	for _, s := range stale {
+		p.logger.Infof("服务器当前时间大于订单 %s 创建时间%d毫秒，订单超时，开始取消", s.order.Id, s.age)
+		_, err := p.b1client.CancelOrder(time.Now().UnixNano(), s.order.Id)
+		p.countCancel(strings.ToUpper(s.order.Side), err)
+		if err != nil {
+			p.logger.Infof("取消订单 %s 失败. %s", s.order.Id, err)
+		}
+		<-tk.C
+	}
+}
@@ -0,0 +1,115 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func staleIds(stale []*staleOrder) []string {
+	var ids = make([]string, 0, len(stale))
+	for _, s := range stale {
+		ids = append(ids, s.order.Id)
+	}
+	return ids
+}
+
+func TestStaleOrders(t *testing.T) {
+	var (
+		now = time.Now()
+		p   = newTestExchange(&model.Configuration{}, nil)
+	)
+	p.bidPrice, p.askPrice = 100, 102
+	p.owned.add("1")
+	p.owned.add("3")
+	p.owned.sign(orderSignature(p.symbolPair.UUID, "ASK", "105", "1"))
+
+	order := func(id, side, price, amount, filled string, age time.Duration) *model.Edge {
+		return &model.Edge{Node: &model.Order{Id: id, Side: side, Price: price, Amount: amount, FilledAmount: filled,
+			InsertedAt: now.Add(-age)}}
+	}
+	edges := []*model.Edge{
+		order("1", "BID", "99.00", "1.0000", "0", 10*time.Minute),
+		order("2", "BID", "90.00", "1.0000", "0", 5*time.Minute),
+		order("3", "ASK", "110.00", "1.0000", "0.6", 3*time.Minute),
+		order("4", "ASK", "103.00", "1.0000", "0", 30*time.Second),
+		order("5", "BID", "95.00", "1.0000", "0", 20*time.Minute),
+		order("6", "ASK", "104.00", "1.5000", "0", 2*time.Minute),
+		order("7", "ASK", "105.00", "1.0000", "0", 4*time.Minute),
+	}
+
+	for _, c := range []struct {
+		name   string
+		policy model.CancelPolicyConfig
+		otype  int
+		ids    []string
+	}{
+		// 没有超时的订单和deny_ids、deny_amounts中的订单不取消
+		{name: "age", otype: AllOrderType, ids: []string{"1", "2", "7", "3"}},
+		{name: "distance", policy: model.CancelPolicyConfig{Priority: model.CancelPriorityDistance}, otype: AllOrderType,
+			ids: []string{"2", "3", "7", "1"}},
+		{name: "bid only", otype: BidOrderType, ids: []string{"1", "2"}},
+		{name: "ask only", otype: AskOrderType, ids: []string{"7", "3"}},
+		{name: "owned only", policy: model.CancelPolicyConfig{OwnedOnly: true}, otype: AllOrderType, ids: []string{"1", "3"}},
+		{name: "owned by signature", policy: model.CancelPolicyConfig{OwnedOnly: true, MatchSignature: true},
+			otype: AllOrderType, ids: []string{"1", "7", "3"}},
+		{name: "allow ids", policy: model.CancelPolicyConfig{OwnedOnly: true, AllowIds: []string{"2"}},
+			otype: AllOrderType, ids: []string{"1", "2", "3"}},
+		{name: "max filled percent", policy: model.CancelPolicyConfig{MaxFilledPercent: 50}, otype: AllOrderType,
+			ids: []string{"1", "2", "7"}},
+		{name: "max filled percent not reached", policy: model.CancelPolicyConfig{MaxFilledPercent: 60},
+			otype: AllOrderType, ids: []string{"1", "2", "7", "3"}},
+	} {
+		var (
+			policy = c.policy
+			cfg    = &model.Configuration{CancelOrderDiffrentTime: 60000, CancelPolicy: &policy}
+		)
+		policy.DenyIds = []string{"5"}
+		policy.DenyAmounts = []string{"1.5"}
+
+		if ids := staleIds(p.staleOrders(cfg, edges, now.UnixNano(), c.otype)); !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: 取消订单 %v, 应为 %v", c.name, ids, c.ids)
+		}
+	}
+}
+
+func TestBatchCancelable(t *testing.T) {
+	var (
+		stale = []*staleOrder{{order: &model.Order{Id: "1"}}, {order: &model.Order{Id: "2"}}}
+		edges = []*model.Edge{{Node: &model.Order{Id: "1"}}, {Node: &model.Order{Id: "2"}}}
+		batch = model.CancelPolicyConfig{BatchThreshold: 2}
+	)
+
+	for _, c := range []struct {
+		name   string
+		policy model.CancelPolicyConfig
+		state  string
+		list   *model.OrderList
+		otype  int
+		batch  bool
+	}{
+		{name: "all stale", policy: batch, state: model.OrderPendingState, list: &model.OrderList{Edges: edges},
+			otype: AllOrderType, batch: true},
+		{name: "last page", policy: batch, state: model.OrderPendingState,
+			list: &model.OrderList{Edges: edges, PageInfo: &model.Page{HasPreviousPage: true}}, otype: AllOrderType, batch: true},
+		{name: "disabled", state: model.OrderPendingState, list: &model.OrderList{Edges: edges}, otype: AllOrderType},
+		{name: "below threshold", policy: model.CancelPolicyConfig{BatchThreshold: 3}, state: model.OrderPendingState,
+			list: &model.OrderList{Edges: edges}, otype: AllOrderType},
+		{name: "owned only", policy: model.CancelPolicyConfig{BatchThreshold: 2, OwnedOnly: true},
+			state: model.OrderPendingState, list: &model.OrderList{Edges: edges}, otype: AllOrderType},
+		{name: "filled state", policy: batch, state: model.OrderFilledState, list: &model.OrderList{Edges: edges},
+			otype: AllOrderType},
+		{name: "one side", policy: batch, state: model.OrderPendingState, list: &model.OrderList{Edges: edges},
+			otype: BidOrderType},
+		// 订单列表有下一页时不知道其他订单是否需要取消
+		{name: "partial page", policy: batch, state: model.OrderPendingState,
+			list: &model.OrderList{Edges: edges, PageInfo: &model.Page{HasNextPage: true}}, otype: AllOrderType},
+		{name: "not all stale", policy: batch, state: model.OrderPendingState,
+			list: &model.OrderList{Edges: append(edges, &model.Edge{Node: &model.Order{Id: "3"}})}, otype: AllOrderType},
+	} {
+		if ok := batchCancelable(&c.policy, c.state, stale, c.list, c.otype); ok != c.batch {
+			t.Errorf("%s: 批量取消 %v, 应为 %v", c.name, ok, c.batch)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/api"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 公共接口客户端的名称，用于区分账户客户端的熔断状态
+const publicClientName = "public"
+
+// 多账户交易管理，每个账户单独启动，一个账户失败不影响其他账户
+type Cluster struct {
+	config   *model.Configuration
+	checker  *limitationChecker
+	timer    *scheduler.Scheduler
+	managers []*Manager
+	cross    *crossExchange
+	sync.RWMutex
+
+	// 保证同一时间只有一次重新加载配置
+	reloading sync.Mutex
+}
+
+// 创建多账户交易管理
+func NewCluster(cfg *model.Configuration) (*Cluster, error) {
+	client := api.NewClient(cfg.EndPoint, "", "", cfg.RequestTimeout, cfg.RequestRateLimit)
+	client.SetCircuitBreaker(publicClientName, cfg.CircuitBreaker)
+	checker, err := newLimitationChecker(cfg, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{
+		config:  cfg,
+		checker: checker,
+	}, nil
+}
+
+// 启动所有账户
+func (p *Cluster) Start() {
+	t := scheduler.New(func(job scheduler.Job, err error) {
+		log.Logger.Errorf("定时任务 %T 执行失败, %s", job, err)
+	})
+
+	log.Logger.Infof("启动调度器")
+	t.Start()
+	p.timer = t
+
+	if p.config.EnableCheckLimitation {
+		p.checker.Start(t)
+	}
+
+	for _, cfg := range p.config.AccountConfigs() {
+		go p.startAccount(cfg)
+	}
+
+	go p.WatchConfig()
+}
+
+// 创建并启动账户，失败时等待后重试，不影响其他账户
+func (p *Cluster) startAccount(cfg *model.Configuration) {
+	var logger = log.Logger.With("account", cfg.Account)
+
+	for {
+		mgr, err := newManager(cfg, p.checker)
+		if err != nil {
+			logger.Errorf("创建账户交易客户端失败, %s", err)
+			logger.Infof("等待%d毫秒再次尝试", cfg.CreateExchangeClientWaitTime)
+			time.Sleep(time.Duration(cfg.CreateExchangeClientWaitTime) * time.Millisecond)
+			continue
+		}
+
+		logger.Infof("创建账户交易客户端成功")
+		p.Lock()
+		p.managers = append(p.managers, mgr)
+		p.Unlock()
+
+		p.checker.Register(mgr.exchanges...)
+		mgr.Start(p.timer)
+		p.startCross()
+		return
+	}
+}
+
+// 跨账户对敲的两个账户都启动后启动跨账户对敲
+func (p *Cluster) startCross() {
+	if p.config.Cross == nil || !p.config.Cross.Enable {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.cross != nil {
+		return
+	}
+
+	var bidMgr, askMgr *Manager
+	for _, mgr := range p.managers {
+		switch mgr.name {
+		case p.config.Cross.BidAccount:
+			bidMgr = mgr
+		case p.config.Cross.AskAccount:
+			askMgr = mgr
+		}
+	}
+
+	if bidMgr == nil || askMgr == nil {
+		return
+	}
+
+	cross, err := newCrossExchange(p.config, bidMgr, askMgr, p.checker.Limitation())
+	if err != nil {
+		log.Logger.Errorf("创建跨账户交易失败, %s", err)
+		return
+	}
+
+	p.cross = cross
+	p.checker.Register(cross.bid)
+	cross.Start(p.timer)
+}
+
+// 根据account参数查找账户，未指定时返回第一个已启动的账户
+func (p *Cluster) manager(account string) *Manager {
+	p.RLock()
+	defer p.RUnlock()
+
+	for _, mgr := range p.managers {
+		if account == "" || mgr.name == account {
+			return mgr
+		}
+	}
+
+	return nil
+}
+
+// 输出所有账户的状态
+func (p *Cluster) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	p.RLock()
+	managers := p.managers
+	cross := p.cross
+	p.RUnlock()
+
+	for _, mgr := range managers {
+		mgr.ServeHTTP(resp, req)
+	}
+
+	if cross != nil {
+		cross.ServeHTTP(resp, req)
+	}
+}
+
+// 根据account和market参数查找交易市场
+func (p *Cluster) exchange(req *http.Request) *Exchange {
+	mgr := p.manager(req.URL.Query().Get("account"))
+	if mgr == nil {
+		return nil
+	}
+	return mgr.exchange(req.URL.Query().Get("market"))
+}
+
+// 以json格式输出指定账户和市场的每小时挖矿份额
+func (p *Cluster) ServeShare(resp http.ResponseWriter, req *http.Request) {
+	ex := p.exchange(req)
+	if ex == nil {
+		http.Error(resp, "market not found", http.StatusNotFound)
+		return
+	}
+	ex.ServeShare(resp, req)
+}
+
+// 以csv格式导出指定账户和市场的每小时挖矿份额
+func (p *Cluster) ServeShareCSV(resp http.ResponseWriter, req *http.Request) {
+	ex := p.exchange(req)
+	if ex == nil {
+		http.Error(resp, "market not found", http.StatusNotFound)
+		return
+	}
+	ex.ServeShareCSV(resp, req)
+}
+
+// 以json格式输出指定账户和市场的每天盈亏
+func (p *Cluster) ServePnl(resp http.ResponseWriter, req *http.Request) {
+	ex := p.exchange(req)
+	if ex == nil {
+		http.Error(resp, "market not found", http.StatusNotFound)
+		return
+	}
+	ex.ServePnl(resp, req)
+}
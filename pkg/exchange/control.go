@@ -0,0 +1,247 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 控制接口路径前缀
+const controlPathPrefix = "/api/v1/control/"
+
+// 控制接口操作
+const (
+	ControlPause           = "pause"
+	ControlResume          = "resume"
+	ControlCancelLock      = "cancel/lock"
+	ControlCancelUnlock    = "cancel/unlock"
+	ControlCancelSweep     = "cancel/sweep"
+	ControlRebalanceLock   = "rebalance/lock"
+	ControlRebalanceUnlock = "rebalance/unlock"
+	ControlLimitationCheck = "limitation/check"
+	ControlConfigReload    = "config/reload"
+	ControlRiskReset       = "risk/reset"
+)
+
+// 控制接口返回结果
+type ControlResult struct {
+	Action  string                `json:"action"`
+	Markets []string              `json:"markets"`
+	Changes []*model.ConfigChange `json:"changes,omitempty"`
+	Message string                `json:"message,omitempty"`
+}
+
+// 是否暂停自动交易
+func (p *Exchange) isPaused() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.paused
+}
+
+// 暂停或恢复自动交易
+func (p *Exchange) SetPaused(paused bool) {
+	p.Lock()
+	p.paused = paused
+	p.Unlock()
+	p.logger.Infof("控制接口设置自动交易暂停为 %v", paused)
+}
+
+// 锁定或解锁自动撤单
+func (p *Exchange) HoldCancel(held bool) {
+	p.Lock()
+	p.cancelHeld = held
+	p.Unlock()
+	p.logger.Infof("控制接口设置自动撤单锁定为 %v", held)
+}
+
+// 锁定或解锁平衡资产
+func (p *Exchange) HoldBalance(held bool) {
+	p.Lock()
+	p.balanceHeld = held
+	p.Unlock()
+	p.logger.Infof("控制接口设置平衡资产锁定为 %v", held)
+}
+
+// 立即检查并取消超时订单，已有待处理的撤单信号时返回false
+func (p *Exchange) SweepOrders() bool {
+	select {
+	case p.cancelOrderChan <- AllOrderType:
+		return true
+	default:
+		return false
+	}
+}
+
+// 立即检查挖矿限量，已有待处理的检查信号时返回false
+func (p *limitationChecker) Check() bool {
+	select {
+	case p.checkLimitationChan <- CheckLimitationType:
+		return true
+	default:
+		return false
+	}
+}
+
+// 检查控制接口访问令牌
+func (p *Cluster) authorized(req *http.Request) bool {
+	cfg := p.conf()
+	if cfg.ControlToken == "" {
+		return false
+	}
+
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.ControlToken)) == 1
+}
+
+// 根据account和market参数查找交易市场，参数为空时匹配所有，包括跨账户对敲的买卖账户
+func (p *Cluster) targets(account, market string) []*Exchange {
+	p.RLock()
+	defer p.RUnlock()
+
+	var (
+		exs   []*Exchange
+		match = func(name string, ex *Exchange) bool {
+			return (account == "" || name == account) &&
+				(market == "" || ex.symbolPair.Name == strings.ToUpper(market))
+		}
+	)
+
+	for _, mgr := range p.managers {
+		for _, ex := range mgr.exchanges {
+			if match(mgr.name, ex) {
+				exs = append(exs, ex)
+			}
+		}
+	}
+
+	if p.cross != nil {
+		for _, ex := range []*Exchange{p.cross.bid, p.cross.ask} {
+			if match(ex.conf().Account, ex) {
+				exs = append(exs, ex)
+			}
+		}
+	}
+
+	return exs
+}
+
+// 是否为跨账户对敲的买卖账户
+func (p *Cluster) crossLeg(ex *Exchange) bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.cross != nil && (ex == p.cross.bid || ex == p.cross.ask)
+}
+
+// 运行时控制接口，所有操作记录到审计日志
+// POST /api/v1/control/{action}?account=xxx&market=xxx
+func (p *Cluster) ServeControl(resp http.ResponseWriter, req *http.Request) {
+	var (
+		action  = strings.TrimPrefix(req.URL.Path, controlPathPrefix)
+		account = req.URL.Query().Get("account")
+		market  = req.URL.Query().Get("market")
+		result  = &ControlResult{Action: action, Markets: []string{}}
+		status  = http.StatusOK
+	)
+
+	defer func() {
+		log.Audit.Infow("control",
+			"remote", req.RemoteAddr,
+			"action", action,
+			"account", account,
+			"market", market,
+			"status", status,
+			"markets", result.Markets,
+			"message", result.Message)
+	}()
+
+	if !p.authorized(req) {
+		status = http.StatusUnauthorized
+		http.Error(resp, "unauthorized", status)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		status = http.StatusMethodNotAllowed
+		http.Error(resp, "method not allowed", status)
+		return
+	}
+
+	if action == ControlLimitationCheck {
+		if !p.conf().EnableCheckLimitation {
+			status = http.StatusConflict
+			result.Message = "limitation check disabled"
+		} else if !p.checker.Check() {
+			result.Message = "limitation check already pending"
+		}
+		p.writeControlResult(resp, status, result)
+		return
+	}
+
+	if action == ControlConfigReload {
+		reload, err := p.Reload("control")
+		if err != nil {
+			status = http.StatusConflict
+			result.Message = err.Error()
+		}
+		result.Changes = reload.Applied
+		p.writeControlResult(resp, status, result)
+		return
+	}
+
+	exs := p.targets(account, market)
+	if len(exs) == 0 {
+		status = http.StatusNotFound
+		http.Error(resp, "market not found", status)
+		return
+	}
+
+	for _, ex := range exs {
+		name := fmt.Sprintf("%s/%s", ex.conf().Account, ex.symbolPair.Name)
+		if p.crossLeg(ex) {
+			// 跨账户对敲不自动撤单和平衡资产，只支持暂停、恢复和恢复风险控制
+			switch action {
+			case ControlCancelLock, ControlCancelUnlock, ControlRebalanceLock, ControlRebalanceUnlock, ControlCancelSweep:
+				continue
+			}
+			name += "(cross)"
+		}
+
+		switch action {
+		case ControlPause:
+			ex.SetPaused(true)
+		case ControlResume:
+			ex.SetPaused(false)
+		case ControlCancelLock:
+			ex.HoldCancel(true)
+		case ControlCancelUnlock:
+			ex.HoldCancel(false)
+		case ControlRebalanceLock:
+			ex.HoldBalance(true)
+		case ControlRebalanceUnlock:
+			ex.HoldBalance(false)
+		case ControlRiskReset:
+			ex.ResetRisk()
+		case ControlCancelSweep:
+			if !ex.SweepOrders() {
+				name += "(pending)"
+			}
+		default:
+			status = http.StatusNotFound
+			http.Error(resp, "unknown action", status)
+			return
+		}
+		result.Markets = append(result.Markets, name)
+	}
+
+	p.writeControlResult(resp, status, result)
+}
+
+func (p *Cluster) writeControlResult(resp http.ResponseWriter, status int, result *ControlResult) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	json.NewEncoder(resp).Encode(result)
+}
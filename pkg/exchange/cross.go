@@ -0,0 +1,410 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 跨账户对敲，买单由一个账户下单，卖单由另一个账户下单。
+// inventory为买入账户相对启动时净买入的base数量，超过阈值后在两个账户之间对敲换回
+type crossExchange struct {
+	config *model.CrossConfig
+	bid    *Exchange // bid_account 的交易市场
+	ask    *Exchange // ask_account 的交易市场
+	logger *zap.SugaredLogger
+	sync.Mutex
+
+	inventory float64
+	reversed  bool // 为true时由bid_account卖出，ask_account买入
+
+	exchangeChan  chan int
+	rebalanceChan chan chan struct{}
+
+	// 加入调度器的定时任务，任务执行方式修改后重新调度
+	scheduleConfig *model.Configuration
+	exchangeEntry  *scheduler.Entry
+	rebalanceEntry *scheduler.Entry
+}
+
+// 创建跨账户对敲
+func newCrossExchange(cfg *model.Configuration, bidMgr, askMgr *Manager, limitation float64) (*crossExchange, error) {
+	var legs [2]*Exchange
+	for i, mgr := range []*Manager{bidMgr, askMgr} {
+		leg, err := mgr.newLeg(crossLegConfig(mgr.config, cfg.Cross), limitation)
+		if err != nil {
+			return nil, err
+		}
+		legs[i] = leg
+	}
+
+	return &crossExchange{
+		config:        cfg.Cross,
+		bid:           legs[0],
+		ask:           legs[1],
+		logger:        log.Logger.With("cross", fmt.Sprintf("%s/%s", bidMgr.name, askMgr.name), "market", cfg.Cross.SymbolPair),
+		exchangeChan:  make(chan int, 1),
+		rebalanceChan: make(chan chan struct{}, 1),
+	}, nil
+}
+
+// 跨账户对敲交易市场的配置，使用账户配置并替换交易对和交易数量
+func crossLegConfig(account *model.Configuration, cross *model.CrossConfig) *model.Configuration {
+	var c = *account
+	c.SymbolPair = cross.SymbolPair
+	c.ExchangeAmount = cross.ExchangeAmount
+	c.ShareTrackEnable = false
+
+	// 跨账户对敲使用单独的盈亏报告文件
+	if c.PnlEnabled() {
+		var pnl = *c.Pnl
+		ext := filepath.Ext(pnl.ReportFile)
+		pnl.ReportFile = fmt.Sprintf("%s-cross-%s%s", strings.TrimSuffix(pnl.ReportFile, ext), c.SymbolPair, ext)
+		c.Pnl = &pnl
+	}
+
+	return &c
+}
+
+// 获取交易市场的可用base和quote数量
+func (p *Exchange) availableBalance() (base, quote float64, err error) {
+	account, err := p.b1client.GetAccounts(time.Now().UnixNano())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, v := range account.Data {
+		var balance, locked float64
+		balance, err = strconv.ParseFloat(v.Balance, 10)
+		if err != nil {
+			return 0, 0, err
+		}
+		locked, err = strconv.ParseFloat(v.LockedBalance, 10)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		switch v.AssetUUID {
+		case p.symbolPair.BaseAsset.UUID:
+			base = balance - locked
+		case p.symbolPair.QuoteAsset.UUID:
+			quote = balance - locked
+		}
+	}
+
+	return base, quote, nil
+}
+
+// 当前的买入和卖出账户
+func (p *crossExchange) sides() (buyer, seller *Exchange, reversed bool) {
+	p.Lock()
+	defer p.Unlock()
+	if p.reversed {
+		return p.ask, p.bid, true
+	}
+	return p.bid, p.ask, false
+}
+
+// 跨账户交易
+func (p *crossExchange) Exchange() {
+	for {
+		select {
+		case <-p.exchangeChan:
+			p.bid.RLock()
+			keepRunning := p.bid.keepRunning
+			p.bid.RUnlock()
+			if !keepRunning {
+				p.logger.Debugf("已达到限额，停止挖矿")
+				break
+			}
+
+			if reason := p.blocked(); reason != "" {
+				p.logger.Debugf("%s", reason)
+				break
+			}
+
+			go p.exchange()
+		}
+	}
+}
+
+// 不能下单时返回原因
+func (p *crossExchange) blocked() string {
+	if ok, reason := p.bid.conf().TradingAllowed(time.Now()); !ok {
+		return fmt.Sprintf("当前不在交易时间内, %s", reason)
+	}
+
+	if p.bid.isPaused() || p.ask.isPaused() {
+		return "跨账户交易已暂停"
+	}
+
+	if p.bid.risk.isHalted() || p.ask.risk.isHalted() {
+		return "已触发风险控制限额，停止跨账户交易"
+	}
+
+	if open := append(p.bid.b1client.OpenCircuits(), p.ask.b1client.OpenCircuits()...); len(open) != 0 {
+		return fmt.Sprintf("api熔断中，暂停跨账户交易. %s", strings.Join(open, ", "))
+	}
+
+	return ""
+}
+
+func (p *crossExchange) exchange() {
+	buyer, seller, reversed := p.sides()
+	p.trade(buyer, seller, reversed, p.config.ExchangeAmount, metrics.PurposeCross)
+}
+
+// 由buyer买入、seller卖出amount数量的base，返回成交数量
+func (p *crossExchange) trade(buyer, seller *Exchange, reversed bool, amount float64, purpose string) float64 {
+	var (
+		buyOrder  *model.Order
+		sellOrder *model.Order
+		wg        sync.WaitGroup
+	)
+
+	buyerCfg, sellerCfg := buyer.conf(), seller.conf()
+
+	// 补记之前的对敲在下单返回后才成交的数量
+	buyer.reconcileFills()
+	seller.reconcileFills()
+
+	ticker, err := buyer.b1client.GetTicker(buyer.symbolPair.Name)
+	if err != nil {
+		p.logger.Errorf("获取行情数据失败. %s", err)
+		return 0
+	}
+
+	if !buyer.checkTicker(buyerCfg, ticker) {
+		return 0
+	}
+
+	askPrice, err := strconv.ParseFloat(ticker.Data.Ask.Price, 10)
+	if err != nil {
+		p.logger.Errorf("转换当前ask价格为float类型失败")
+		return 0
+	}
+
+	if !buyer.allowRisk(buyerCfg, BidOrderTypeName, amount, askPrice) ||
+		!seller.allowRisk(sellerCfg, AskOrderTypeName, amount, askPrice) {
+		return 0
+	}
+
+	price := fmt.Sprintf(buyer.priceFormat, math.Abs(askPrice-buyerCfg.ExpectDiffrentValue))
+	size := fmt.Sprintf(buyer.amountFormat, amount)
+	nonce := time.Now().UnixNano()
+
+	wg.Add(2)
+	go func() {
+		var err error
+		defer wg.Done()
+		buyOrder, err = buyer.Bid(nonce, buyer.symbolPair.UUID, price, size)
+		buyer.countOrder(BidOrderTypeName, purpose, err)
+		p.logger.Infof("跨账户交易时创建BID买入订单price: %s, amount: %s", price, size)
+		if err != nil {
+			p.logger.Errorf("创建BID买入订单失败. %s", err)
+		}
+	}()
+	go func() {
+		var err error
+		defer wg.Done()
+		sellOrder, err = seller.Ask(nonce+1, seller.symbolPair.UUID, price, size)
+		seller.countOrder(AskOrderTypeName, purpose, err)
+		p.logger.Infof("跨账户交易时创建ASK卖出订单price: %s, amount: %s", price, size)
+		if err != nil {
+			p.logger.Errorf("创建ASK卖出订单失败. %s", err)
+		}
+	}()
+	wg.Wait()
+
+	buyer.recordRisk(buyerCfg, purpose, askPrice, buyOrder)
+	seller.recordRisk(sellerCfg, purpose, askPrice, sellOrder)
+
+	// 订单在下单返回后成交时补记资产偏移、风险控制统计和挂单成交的盈亏
+	washPrice := math.Abs(askPrice - buyerCfg.ExpectDiffrentValue)
+	onBuyFill := func(delta float64) {
+		buyer.recordLateRisk(buyerCfg, BidOrderTypeName, delta, askPrice)
+		buyer.recordWashFill(buyerCfg, BidOrderTypeName, washPrice, delta, true)
+		p.Lock()
+		if reversed {
+			p.inventory -= delta
+		} else {
+			p.inventory += delta
+		}
+		p.Unlock()
+	}
+	onSellFill := func(delta float64) {
+		seller.recordLateRisk(sellerCfg, AskOrderTypeName, delta, askPrice)
+		seller.recordWashFill(sellerCfg, AskOrderTypeName, washPrice, delta, true)
+	}
+
+	// 两个订单属于不同账户，每个账户只能查询自己的订单，下单时已成交的数量按吃单记录，之后成交的在补记时记录
+	filled := buyer.recordFilled(askPrice, onBuyFill, buyOrder)
+	sold := seller.recordFilled(askPrice, onSellFill, sellOrder)
+	buyer.recordWashPnl(buyerCfg, washPrice, filled, buyOrder)
+	seller.recordWashPnl(sellerCfg, washPrice, sold, sellOrder)
+
+	p.Lock()
+	if reversed {
+		p.inventory -= filled
+	} else {
+		p.inventory += filled
+	}
+	p.Unlock()
+
+	return filled
+}
+
+// 根据累计的资产偏移和两个账户的可用资产决定交易方向
+func (p *crossExchange) Rebalance() {
+	for {
+		select {
+		case done := <-p.rebalanceChan:
+			p.rebalance()
+			close(done)
+		}
+	}
+}
+
+func (p *crossExchange) rebalance() {
+	bidBase, bidQuote, err := p.bid.availableBalance()
+	if err != nil {
+		p.logger.Errorf("获取买入账户资产失败. %s", err)
+		return
+	}
+
+	askBase, askQuote, err := p.ask.availableBalance()
+	if err != nil {
+		p.logger.Errorf("获取卖出账户资产失败. %s", err)
+		return
+	}
+
+	p.Lock()
+	inventory := p.inventory
+	p.Unlock()
+
+	p.logger.Infof("买入账户可用 base: %f, quote: %f; 卖出账户可用 base: %f, quote: %f; 累计偏移: %f",
+		bidBase, bidQuote, askBase, askQuote, inventory)
+
+	// 偏移超过阈值时由持有多余base的账户卖给另一个账户，将资产换回
+	if math.Abs(inventory) > p.config.RebalanceThreshold {
+		buyer, seller, reversed, available := p.ask, p.bid, true, bidBase
+		if inventory < 0 {
+			buyer, seller, reversed, available = p.bid, p.ask, false, askBase
+		}
+
+		amount := math.Min(math.Abs(inventory), available)
+		if reason := p.blocked(); reason != "" {
+			p.logger.Infof("无法换回资产, %s", reason)
+		} else if amount < math.Pow10(-seller.symbolPair.QuoteScale) {
+			p.logger.Infof("卖出账户base不足，无法换回资产")
+		} else if filled := p.trade(buyer, seller, reversed, amount, metrics.PurposeBalance); filled > 0 {
+			if reversed {
+				bidBase -= filled
+			} else {
+				askBase -= filled
+			}
+
+			p.Lock()
+			inventory = p.inventory
+			p.Unlock()
+			p.logger.Infof("换回资产 %f, 当前偏移: %f", filled, inventory)
+			if math.Abs(inventory) <= p.config.RebalanceThreshold {
+				p.logger.Infof("跨账户资产偏移已恢复")
+			}
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	// 未能换回时互换交易方向，由后续交易继续换回
+	var reversed = p.reversed
+	switch {
+	case p.inventory > p.config.RebalanceThreshold:
+		reversed = true
+	case p.inventory < -p.config.RebalanceThreshold:
+		reversed = false
+	}
+
+	// 卖出账户base不足时必须互换方向
+	if !reversed && askBase < p.config.ExchangeAmount {
+		reversed = true
+	} else if reversed && bidBase < p.config.ExchangeAmount {
+		reversed = false
+	}
+
+	if reversed != p.reversed {
+		p.logger.Infof("互换跨账户交易方向, 当前由%s买入", map[bool]string{false: "bid_account", true: "ask_account"}[reversed])
+		p.reversed = reversed
+	}
+}
+
+// 输出跨账户对敲状态
+func (p *crossExchange) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+
+	s := fmt.Sprintf(`[cross/%s]
+	bidAccount      %s
+	askAccount      %s
+	inventory       %f
+	reversed        %v
+	`, p.config.SymbolPair, p.config.BidAccount, p.config.AskAccount, p.inventory, p.reversed)
+
+	resp.Write([]byte(s))
+}
+
+// 启动跨账户对敲
+func (p *crossExchange) Start(t *scheduler.Scheduler) {
+	p.logger.Infof("启动跨账户交易服务")
+	go p.Exchange()
+	go p.Rebalance()
+
+	p.rebalanceChan <- make(chan struct{})
+	cfg := p.bid.conf()
+	exchangeEntry := t.Add(newRunExchange(p.exchangeChan), time.Duration(p.config.ExchangeInterval)*time.Millisecond,
+		cfg.ScheduleMode(model.ScheduleCrossExchange))
+	rebalanceEntry := t.Add(newRunRebalance(p.rebalanceChan), time.Duration(p.config.RebalanceInterval)*time.Millisecond,
+		cfg.ScheduleMode(model.ScheduleCrossRebalance))
+
+	p.Lock()
+	p.scheduleConfig = cfg
+	p.exchangeEntry = exchangeEntry
+	p.rebalanceEntry = rebalanceEntry
+	p.Unlock()
+}
+
+// 跨账户对敲的配置修改需要重启，两个账户的交易市场使用新的账户配置，并按新配置的任务执行方式重新调度
+func (p *crossExchange) applyConfig(cfg *model.Configuration) {
+	for _, a := range cfg.AccountConfigs() {
+		switch a.Account {
+		case p.config.BidAccount:
+			p.bid.applyConfig(crossLegConfig(a, p.config))
+		case p.config.AskAccount:
+			p.ask.applyConfig(crossLegConfig(a, p.config))
+		}
+	}
+
+	p.Lock()
+	old := p.scheduleConfig
+	p.scheduleConfig = cfg
+	exchangeEntry, rebalanceEntry := p.exchangeEntry, p.rebalanceEntry
+	p.Unlock()
+
+	if old == nil {
+		return
+	}
+	reschedule(exchangeEntry, old, cfg, p.config.ExchangeInterval, p.config.ExchangeInterval, model.ScheduleCrossExchange)
+	reschedule(rebalanceEntry, old, cfg, p.config.RebalanceInterval, p.config.RebalanceInterval, model.ScheduleCrossRebalance)
+}
@@ -3,13 +3,17 @@ package exchange
 import (
 	"b1Exchange/pkg/api"
 	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
 	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 const (
@@ -50,19 +54,48 @@ type Exchange struct {
 	currentBalances map[string]*model.Balance
 	currentTicker   *model.MarketTickerResponeBody
 	b1client        *api.Client
+	logger          *zap.SugaredLogger
 
 	config *model.Configuration
 	sync.RWMutex
 
+	// 配置的交易数量，资产不足降低交易数量后用于恢复
+	configAmount float64
+
+	// 正在执行拆分的平衡资产订单，以及最近一次执行结果
+	executing     bool
+	lastExecution *ExecutionReport
+
 	limitation  float64
 	keepRunning bool
 	stat        *model.OneHourlyLimitationResponeBody
-
-	checkBalanceChan    chan int // 检查账户余额信号管道
-	balanceChan         chan int // 平衡资产信号管道
-	exchangeChan        chan int // 交易信号管道
-	cancelOrderChan     chan int // 取消订单信号管道
-	checkLimitationChan chan int // 检查挖矿限量管道
+	volume      *volumeTracker
+
+	hourlyVolume *volumeTracker
+	fills        *fillRounds
+	yield        *yieldEstimate
+	share        *accountShare
+	risk         *riskGuard
+	pnl          *pnlLedger
+	owned        *orderRegistry
+	price        *priceGuard
+
+	exchangeLocked    bool
+	cancelOrderLocked bool
+
+	// 通过控制接口设置的状态，不受自动加锁解锁影响
+	paused      bool
+	cancelHeld  bool
+	balanceHeld bool
+	lastCycle   CycleTimings
+	errors      *errorRing
+
+	checkBalanceChan chan int // 检查账户余额信号管道
+	balanceChan      chan int // 平衡资产信号管道
+	exchangeChan     chan int // 交易信号管道
+	cancelOrderChan  chan int // 取消订单信号管道
+	// 定时撤单信号管道，撤单检查结束后关闭传入的管道
+	cancelSweepChan chan chan struct{}
 
 	// 耗时统计管道
 	checkBalanceTimeChan chan int64
@@ -72,59 +105,58 @@ type Exchange struct {
 
 	exchangeLockChan    chan bool
 	cancelOrderLockChan chan bool
-}
 
-// 创建新的交易客户端
-func NewExchange(cfg *model.Configuration) (*Exchange, error) {
-	client := api.NewClient(cfg.EndPoint, cfg.AppKey, cfg.AppSecret, cfg.RequestTimeout)
-	markets, err := client.GetAllMarkets()
-	if err != nil {
-		return nil, err
-	}
+	// 加入调度器的定时任务，修改间隔后重新调度
+	exchangeEntry    *scheduler.Entry
+	cancelOrderEntry *scheduler.Entry
+}
 
+// 创建单个交易市场的交易客户端
+// owned为账户下所有市场共享的机器人订单记录，share为账户的挖矿份额统计，为空时不统计
+func newExchange(cfg *model.Configuration, client *api.Client, pair *model.SymbolPair, limitation float64,
+	owned *orderRegistry, share *accountShare) *Exchange {
 	var (
-		mmap  = make(map[string]*model.SymbolPair)
-		exist bool
-		pair  = strings.ToUpper(cfg.SymbolPair)
+		errs   = new(errorRing)
+		logger = log.Logger.Desugar().WithOptions(zap.Hooks(errs.hook)).Sugar().
+			With("account", cfg.Account, "market", pair.Name)
 	)
-	for _, p := range markets.Data {
-		mmap[p.Name] = p
-	}
-
-	_, exist = mmap[pair]
-	if !exist {
-		return nil, fmt.Errorf("交易对 %s 不存在", pair)
-	}
 
-	log.Logger.Infof("基础资产: %s, 精度: %d, 交易资产: %s, 精度: %d", mmap[pair].BaseAsset.Name, mmap[pair].BaseScale,
-		mmap[pair].QuoteAsset.Name, mmap[pair].QuoteScale)
+	logger.Infof("基础资产: %s, 精度: %d, 交易资产: %s, 精度: %d", pair.BaseAsset.Name, pair.BaseScale,
+		pair.QuoteAsset.Name, pair.QuoteScale)
 
-	lmt, err := client.OneLimitation()
-	if err != nil {
-		log.Logger.Infof("获取限额失败\n")
-		return nil, err
+	var pnl *pnlLedger
+	if cfg.PnlEnabled() {
+		pnl = newPnlLedger(cfg.Pnl.ReportFile)
 	}
 
-	limitation := lmt.Data / 24.0
-	log.Logger.Infof("当前每小时限额：%f\n", limitation)
-
 	return &Exchange{
-		symbolPair:           mmap[pair],
-		priceFormat:          fmt.Sprintf("%%.%df", mmap[pair].BaseScale),
-		amountFormat:         fmt.Sprintf("%%.%df", mmap[pair].QuoteScale),
+		symbolPair:           pair,
+		priceFormat:          fmt.Sprintf("%%.%df", pair.BaseScale),
+		amountFormat:         fmt.Sprintf("%%.%df", pair.QuoteScale),
 		balancePercent:       float64(cfg.BalancePercent) / 100.0,
 		currentBalances:      make(map[string]*model.Balance),
 		currentTicker:        new(model.MarketTickerResponeBody),
 		b1client:             client,
+		logger:               logger,
 		config:               cfg,
+		configAmount:         cfg.ExchangeAmount,
 		keepRunning:          true,
 		limitation:           limitation,
 		stat:                 new(model.OneHourlyLimitationResponeBody),
+		volume:               newVolumeTracker(cfg.VolumeTargetPeriod),
+		hourlyVolume:         newVolumeTracker(model.VolumePeriodHour),
+		fills:                new(fillRounds),
+		share:                share,
+		risk:                 newRiskGuard(),
+		pnl:                  pnl,
+		owned:                owned,
+		price:                new(priceGuard),
+		errors:               errs,
 		checkBalanceChan:     make(chan int, 1),
 		balanceChan:          make(chan int, 1),
 		exchangeChan:         make(chan int, 1),
 		cancelOrderChan:      make(chan int, 1),
-		checkLimitationChan:  make(chan int, 1),
+		cancelSweepChan:      make(chan chan struct{}),
 		checkBalanceTimeChan: make(chan int64, 1),
 		balanceTimeChan:      make(chan int64, 1),
 		exchangeTimeChan:     make(chan int64, 1),
@@ -132,7 +164,23 @@ func NewExchange(cfg *model.Configuration) (*Exchange, error) {
 
 		exchangeLockChan:    make(chan bool, 1),
 		cancelOrderLockChan: make(chan bool, 1),
-	}, nil
+	}
+}
+
+// 获取当前生效的配置，重新加载配置时整体替换，调用方在一次操作中应使用同一个配置
+func (p *Exchange) conf() *model.Configuration {
+	p.RLock()
+	defer p.RUnlock()
+	return p.config
+}
+
+// 修改交易数量，复制配置后替换，不影响正在使用旧配置的操作
+func (p *Exchange) setExchangeAmount(amount float64) {
+	p.Lock()
+	defer p.Unlock()
+	cfg := *p.config
+	cfg.ExchangeAmount = amount
+	p.config = &cfg
 }
 
 //
@@ -144,7 +192,7 @@ func (p *Exchange) Ask(nonce int64, market, price, amount string) (*model.Order,
 		"side":      "ASK",
 	}
 
-	return p.b1client.CreateOrder(nonce, parms)
+	return p.createOrder(nonce, parms)
 }
 
 //
@@ -156,50 +204,48 @@ func (p *Exchange) Bid(nonce int64, market, price, amount string) (*model.Order,
 		"side":      "BID",
 	}
 
-	return p.b1client.CreateOrder(nonce, parms)
+	return p.createOrder(nonce, parms)
 }
 
-//
-func (p *Exchange) CheckOneLimitation() {
-	var (
-		stat        *model.OneHourlyLimitationResponeBody
-		err         error
-		sign        int
-		keepRunning bool
-	)
-
-	for {
-		select {
-		case sign = <-p.checkLimitationChan:
-			stat, err = p.b1client.OneHourlyStatistic()
-			if err != nil {
-				log.Logger.Infof("检查系统当前小时挖矿量失败，%s,将使用上一次获取结果进行检查\n", err)
-				stat = p.stat
-			}
-
-			if sign == CheckLimitationType {
-				log.Logger.Infof("当前每小时挖矿奖励: %f, 当前每小时邀请奖励: %f \n", stat.Data.TradeMineOne, stat.Data.InviteMineOne)
-				pct := (stat.Data.TradeMineOne + stat.Data.InviteMineOne) * 100.0 / p.limitation
-				log.Logger.Infof("当前小时已挖矿量占限额比例: %2.2f%%", pct)
-				if pct >= float64(p.config.OneHourlyLimitationPercent) {
-					log.Logger.Infof("当前小时已挖矿量已超限额的%f，设置停止挖矿", p.config.OneHourlyLimitationPercent)
-					keepRunning = false
-				} else {
-					keepRunning = true
-				}
-			} else {
-				log.Logger.Debugf("收到keepRunning信号")
-				p.keepRunning = true
-			}
+// 下单并记录为机器人创建的订单，下单失败时订单可能已经创建，记录订单签名
+func (p *Exchange) createOrder(nonce int64, parms map[string]string) (*model.Order, error) {
+	order, err := p.b1client.CreateOrder(nonce, parms)
+	switch {
+	case err == nil && order != nil:
+		p.owned.add(order.Id)
+	case err == nil || api.IsUncertain(err):
+		// 没有收到有效响应时订单可能已经创建，交易所明确拒绝时不记录订单签名
+		p.owned.sign(orderSignature(parms["market_id"], parms["side"], parms["price"], parms["amount"]))
+	}
+	return order, err
+}
 
-			log.Logger.Debugf("将要设置p.keepRunging为%v\n", keepRunning)
-			p.Lock()
-			p.keepRunning = keepRunning
-			p.Unlock()
+// 根据挖矿限量检查结果更新交易状态，checked为true时表示进行了限量检查
+func (p *Exchange) updateLimitation(stat *model.OneHourlyLimitationResponeBody, keepRunning, checked bool) {
+	cfg := p.conf()
+	if checked && (cfg.ProfitStopEnable || cfg.ShareTrackEnable || cfg.PnlEnabled()) {
+		yield := p.estimateYield(stat)
+		if cfg.ProfitStopEnable && yield != nil && !yield.Profitable {
+			p.logger.Infof("当前小时挖矿收益手续费比 %f 低于 %f，设置停止挖矿",
+				yield.RewardPerFee, cfg.ProfitMinRewardRatio)
+			keepRunning = false
+		}
+		if p.share != nil {
+			p.updateShare(yield)
+		}
+		p.updatePnlMining(yield)
+		p.Lock()
+		p.yield = yield
+		p.Unlock()
+	}
 
-			p.stat = stat
+	p.Lock()
+	p.keepRunning = keepRunning
+	p.stat = stat
+	p.Unlock()
 
-		}
+	if stat != nil && stat.Data != nil && p.limitation > 0 {
+		p.updateMinedMetrics((stat.Data.TradeMineOne + stat.Data.InviteMineOne) * 100.0 / p.limitation)
 	}
 }
 
@@ -216,18 +262,44 @@ func (p *Exchange) CheckAccountBalance() {
 			p.RUnlock()
 
 			if !keepRunning {
-				log.Logger.Debugf("已达到限额，停止挖矿")
+				p.logger.Debugf("已达到限额，停止挖矿")
+				break
+			}
+
+			if ok, reason := p.conf().TradingAllowed(time.Now()); !ok {
+				p.logger.Debugf("当前不在交易时间内, %s", reason)
+				break
+			}
+
+			if p.isPaused() {
+				p.logger.Debugf("自动交易已暂停")
+				break
+			}
+
+			if p.risk.isHalted() {
+				p.logger.Debugf("已触发风险控制限额，停止交易")
+				break
+			}
+
+			if open := p.b1client.OpenCircuits(); len(open) != 0 {
+				p.logger.Debugf("api熔断中，暂停自动交易. %s", strings.Join(open, ", "))
 				break
 			}
 
 			go func() {
 				var (
+					cfg                = p.conf()
 					err                error
 					start              int64
 					end                int64
 					dtime              int64
+					baseBalance        float64
+					quoteBalance       float64
 					baseLockedBalance  float64
 					quoteLockedBalance float64
+					askPrice           float64
+					bidPrice           float64
+					ticker             *model.MarketTickerResponeBody
 
 					base    = new(model.Balance)
 					quote   = new(model.Balance)
@@ -238,7 +310,7 @@ func (p *Exchange) CheckAccountBalance() {
 					tk      *time.Ticker
 				)
 
-				log.Logger.Infof("开始检查账户资产")
+				p.logger.Infof("开始检查账户资产")
 				start = time.Now().UnixNano()
 				defer func() {
 					end = time.Now().UnixNano()
@@ -247,86 +319,109 @@ func (p *Exchange) CheckAccountBalance() {
 
 				account, err = p.b1client.GetAccounts(start)
 				if err != nil {
-					log.Logger.Errorf("获取账户资产失败. %s", err)
+					p.logger.Errorf("获取账户资产失败. %s", err)
 					return
 				}
 
+				// 状态接口会同时读取资产和行情，更新时加锁
+				p.Lock()
 				for _, v := range account.Data {
 					p.currentBalances[v.AssetUUID] = v
 				}
 
 				base = p.currentBalances[p.symbolPair.BaseAsset.UUID]
 				quote = p.currentBalances[p.symbolPair.QuoteAsset.UUID]
+				p.Unlock()
 
-				p.baseBalance, err = strconv.ParseFloat(base.Balance, 10)
+				baseBalance, err = strconv.ParseFloat(base.Balance, 10)
 				if err != nil {
-					log.Logger.Errorf("转换%s资产数量为float类型失败. %s", p.symbolPair.BaseAsset.Name, err)
+					p.logger.Errorf("转换%s资产数量为float类型失败. %s", p.symbolPair.BaseAsset.Name, err)
 					return
 				}
 
 				baseLockedBalance, err = strconv.ParseFloat(base.LockedBalance, 10)
 				if err != nil {
-					log.Logger.Errorf("转换%资产已锁定数量为float类型失败. %s", p.symbolPair.BaseAsset.Name, err)
+					p.logger.Errorf("转换%资产已锁定数量为float类型失败. %s", p.symbolPair.BaseAsset.Name, err)
 					return
 				}
 
-				p.quoteBalance, err = strconv.ParseFloat(quote.Balance, 10)
+				quoteBalance, err = strconv.ParseFloat(quote.Balance, 10)
 				if err != nil {
-					log.Logger.Errorf("转换%s资产数量为float类型失败. %s", p.symbolPair.QuoteAsset.Name, err)
+					p.logger.Errorf("转换%s资产数量为float类型失败. %s", p.symbolPair.QuoteAsset.Name, err)
 					return
 				}
 
 				quoteLockedBalance, err = strconv.ParseFloat(quote.LockedBalance, 10)
 				if err != nil {
-					log.Logger.Errorf("转换%资产已锁定数量为float类型失败. %s", p.symbolPair.QuoteAsset.Name, err)
+					p.logger.Errorf("转换%资产已锁定数量为float类型失败. %s", p.symbolPair.QuoteAsset.Name, err)
 					return
 				}
 
-				p.baseAvaiable = p.baseBalance - baseLockedBalance
-				p.quoteAvaiable = p.quoteBalance - quoteLockedBalance
+				p.Lock()
+				p.baseBalance = baseBalance
+				p.quoteBalance = quoteBalance
+				p.baseAvaiable = baseBalance - baseLockedBalance
+				p.quoteAvaiable = quoteBalance - quoteLockedBalance
+				p.Unlock()
 
-				log.Logger.Debugf("当前 %s 资产: %f, 可用: %f",
-					p.symbolPair.BaseAsset.Name, p.baseBalance, p.baseAvaiable)
-				log.Logger.Debugf("当前 %s 资产: %f, 可用: %f",
-					p.symbolPair.QuoteAsset.Name, p.quoteBalance, p.quoteAvaiable)
+				p.logger.Debugf("当前 %s 资产: %f, 可用: %f",
+					p.symbolPair.BaseAsset.Name, baseBalance, baseBalance-baseLockedBalance)
+				p.logger.Debugf("当前 %s 资产: %f, 可用: %f",
+					p.symbolPair.QuoteAsset.Name, quoteBalance, quoteBalance-quoteLockedBalance)
 
-				p.currentTicker, err = p.b1client.GetTicker(p.symbolPair.Name)
+				ticker, err = p.b1client.GetTicker(p.symbolPair.Name)
 				if err != nil {
-					log.Logger.Errorf("获取行情数据失败. %s", err)
+					p.logger.Errorf("获取行情数据失败. %s", err)
+					return
+				}
+
+				p.Lock()
+				p.currentTicker = ticker
+				p.Unlock()
+
+				if !p.checkTicker(cfg, ticker) {
 					return
 				}
 
 				// 判断可用账户余额
-				if p.baseAvaiable >= p.config.ExchangeAmount {
+				if baseBalance-baseLockedBalance >= cfg.ExchangeAmount {
 					bflag = 20
 				} else {
 					bflag = 10
 				}
 
-				p.askPrice, err = strconv.ParseFloat(p.currentTicker.Data.Ask.Price, 10)
+				askPrice, err = strconv.ParseFloat(ticker.Data.Ask.Price, 10)
 				if err != nil {
-					log.Logger.Errorf("转换当前ask价格为float类型失败")
+					p.logger.Errorf("转换当前ask价格为float类型失败")
 					return
 				}
 
-				p.bidPrice, err = strconv.ParseFloat(p.currentTicker.Data.Bid.Price, 10)
+				bidPrice, err = strconv.ParseFloat(ticker.Data.Bid.Price, 10)
 				if err != nil {
-					log.Logger.Errorf("转换当前bid价格为float类型失败")
+					p.logger.Errorf("转换当前bid价格为float类型失败")
 					return
 				}
 
-				log.Logger.Debugf("current ask price %f", p.askPrice)
-				if p.quoteAvaiable >= (p.askPrice * p.config.ExchangeAmount) {
+				p.Lock()
+				p.askPrice = askPrice
+				p.bidPrice = bidPrice
+				p.Unlock()
+
+				p.logger.Debugf("current ask price %f", askPrice)
+				p.updateBalanceMetrics()
+				if quoteBalance-quoteLockedBalance >= (askPrice * cfg.ExchangeAmount) {
 					qflag = 2
 				} else {
 					qflag = 1
 				}
 
+				p.restoreExchangeAmount(cfg)
+
 				end = time.Now().UnixNano()
 				dtime = (end - start) / 1000000
-				if dtime < p.config.CheckBalanceRelayTime {
-					tk = time.NewTicker(time.Duration(p.config.CheckBalanceRelayTime-dtime) * time.Millisecond)
-					log.Logger.Infof("检查订单延时 %d 毫秒", p.config.CheckBalanceRelayTime-dtime)
+				if dtime < cfg.CheckBalanceRelayTime {
+					tk = time.NewTicker(time.Duration(cfg.CheckBalanceRelayTime-dtime) * time.Millisecond)
+					p.logger.Infof("检查订单延时 %d 毫秒", cfg.CheckBalanceRelayTime-dtime)
 					<-tk.C
 					tk.Stop()
 				}
@@ -334,24 +429,30 @@ func (p *Exchange) CheckAccountBalance() {
 				code = bflag + qflag
 				switch code {
 				case 22:
-					log.Logger.Infof("账户可用资产足够，准备进行买卖")
+					p.logger.Infof("账户可用资产足够，准备进行买卖")
+					if cfg.BalanceAccountBalance && cfg.RebalanceTargetEnabled() && p.outOfBand(cfg) {
+						select {
+						case p.balanceChan <- 0:
+						default:
+						}
+					}
 					p.exchangeChan <- NormalExchangeType
 					break
 				case 12:
-					log.Logger.Infof("账户%s可用资产不足，准备平衡该资产", p.symbolPair.BaseAsset.Name)
-					if p.config.BalanceAccountBalance {
+					p.logger.Infof("账户%s可用资产不足，准备平衡该资产", p.symbolPair.BaseAsset.Name)
+					if cfg.BalanceAccountBalance {
 						p.balanceChan <- 0
 					}
 					break
 				case 21:
-					log.Logger.Infof("账户%s可用资产不足，准备平衡该资产", p.symbolPair.QuoteAsset.Name)
-					if p.config.BalanceAccountBalance {
+					p.logger.Infof("账户%s可用资产不足，准备平衡该资产", p.symbolPair.QuoteAsset.Name)
+					if cfg.BalanceAccountBalance {
 						p.balanceChan <- 0
 					}
 					break
 				case 11:
-					log.Logger.Infof("账户可用资产不足，准备平衡该资产")
-					if p.config.BalanceAccountBalance {
+					p.logger.Infof("账户可用资产不足，准备平衡该资产")
+					if cfg.BalanceAccountBalance {
 						p.balanceChan <- 0
 					}
 					break
@@ -372,13 +473,29 @@ func (p *Exchange) CountTime() {
 	for {
 		select {
 		case checkBalanceTime = <-p.checkBalanceTimeChan:
-			log.Logger.Infof("检查账户资产使用时间: %d 毫秒", checkBalanceTime/1000000)
+			p.logger.Infof("检查账户资产使用时间: %d 毫秒", checkBalanceTime/1000000)
+			p.observeDuration(metrics.OperationCheckBalance, checkBalanceTime)
+			p.Lock()
+			p.lastCycle.CheckBalance = checkBalanceTime / 1000000
+			p.Unlock()
 		case exchangeTime = <-p.exchangeTimeChan:
-			log.Logger.Infof("交易使用时间: %d 毫秒", exchangeTime/1000000)
+			p.logger.Infof("交易使用时间: %d 毫秒", exchangeTime/1000000)
+			p.observeDuration(metrics.OperationTrade, exchangeTime)
+			p.Lock()
+			p.lastCycle.Exchange = exchangeTime / 1000000
+			p.Unlock()
 		case cancelorderTime = <-p.cancelOrderTimeChan:
-			log.Logger.Infof("检查订单使用时间: %d 毫秒", cancelorderTime/1000000)
+			p.logger.Infof("检查订单使用时间: %d 毫秒", cancelorderTime/1000000)
+			p.observeDuration(metrics.OperationCancel, cancelorderTime)
+			p.Lock()
+			p.lastCycle.CancelOrder = cancelorderTime / 1000000
+			p.Unlock()
 		case balanceTime = <-p.balanceTimeChan:
-			log.Logger.Infof("平衡账户使用时间: %d 毫秒", balanceTime/1000000)
+			p.logger.Infof("平衡账户使用时间: %d 毫秒", balanceTime/1000000)
+			p.observeDuration(metrics.OperationRebalance, balanceTime)
+			p.Lock()
+			p.lastCycle.Balance = balanceTime / 1000000
+			p.Unlock()
 		}
 	}
 }
@@ -393,19 +510,28 @@ func (p *Exchange) Exchange() {
 	for {
 		select {
 		case lock = <-p.exchangeLockChan:
+			p.Lock()
+			p.exchangeLocked = lock
+			p.Unlock()
 			if lock {
-				log.Logger.Infof("锁定自动交易")
+				p.logger.Infof("锁定自动交易")
 			} else {
-				log.Logger.Infof("解锁自动交易")
+				p.logger.Infof("解锁自动交易")
 			}
 		case ecode = <-p.exchangeChan:
 			if lock {
-				log.Logger.Infof("自动交易已锁定")
+				p.logger.Infof("自动交易已锁定")
+				break
+			}
+
+			if p.isPaused() {
+				p.logger.Infof("自动交易已暂停")
 				break
 			}
 
 			go func(code int) {
 				var (
+					cfg           = p.conf()
 					err           error
 					start         int64
 					end           int64
@@ -415,48 +541,82 @@ func (p *Exchange) Exchange() {
 					askPrice      float64
 					currentTicker *model.MarketTickerResponeBody
 					a             float64
+					bidOrder      *model.Order
+					askOrder      *model.Order
+					wg            sync.WaitGroup
 				)
-				log.Logger.Infof("开始进行交易")
+				p.logger.Infof("开始进行交易")
 				start = time.Now().UnixNano()
 				defer func() {
 					end = time.Now().UnixNano()
 					p.exchangeTimeChan <- end - start
 				}()
 
+				// 补记之前的对敲在下单返回后才成交的数量
+				p.reconcileFills()
+
 				if code == NormalExchangeType {
 					a = float64(1)
 				} else {
-					a = float64(p.config.BalanceExchangePercent) / 100.0
+					a = float64(cfg.BalanceExchangePercent) / 100.0
 				}
 
 				currentTicker, err = p.b1client.GetTicker(p.symbolPair.Name)
 				if err != nil {
-					log.Logger.Errorf("获取行情数据失败. %s", err)
+					p.logger.Errorf("获取行情数据失败. %s", err)
+					return
+				}
+
+				if !p.checkTicker(cfg, currentTicker) {
 					return
 				}
 				askPrice, err = strconv.ParseFloat(currentTicker.Data.Ask.Price, 10)
 				if err != nil {
-					log.Logger.Errorf("转换当前ask价格为float类型失败")
+					p.logger.Errorf("转换当前ask价格为float类型失败")
+					return
+				}
+
+				if !p.allowRisk(cfg, "", cfg.ExchangeAmount*a, askPrice) {
 					return
 				}
 
-				price = fmt.Sprintf(p.priceFormat, math.Abs(askPrice-p.config.ExpectDiffrentValue))
-				amount = fmt.Sprintf(p.amountFormat, p.config.ExchangeAmount*a)
+				price = fmt.Sprintf(p.priceFormat, math.Abs(askPrice-cfg.ExpectDiffrentValue))
+				amount = fmt.Sprintf(p.amountFormat, cfg.ExchangeAmount*a)
 				nonce = time.Now().UnixNano()
+				wg.Add(2)
 				go func() {
-					_, err := p.Bid(nonce, p.symbolPair.UUID, price, amount)
-					log.Logger.Infof("交易时创建BID买入订单price: %s, amount: %s", price, amount)
+					var err error
+					defer wg.Done()
+					bidOrder, err = p.Bid(nonce, p.symbolPair.UUID, price, amount)
+					p.countOrder(BidOrderTypeName, metrics.PurposeExchange, err)
+					p.logger.Infof("交易时创建BID买入订单price: %s, amount: %s", price, amount)
 					if err != nil {
-						log.Logger.Errorf("创建BID买入订单失败. %s", err)
+						p.logger.Errorf("创建BID买入订单失败. %s", err)
 					}
 				}()
 				go func() {
-					_, err := p.Ask(nonce+1, p.symbolPair.UUID, price, amount)
-					log.Logger.Infof("交易时时创建ASK卖出订单price: %s, amount: %s", price, amount)
+					var err error
+					defer wg.Done()
+					askOrder, err = p.Ask(nonce+1, p.symbolPair.UUID, price, amount)
+					p.countOrder(AskOrderTypeName, metrics.PurposeExchange, err)
+					p.logger.Infof("交易时时创建ASK卖出订单price: %s, amount: %s", price, amount)
 					if err != nil {
-						log.Logger.Errorf("创建ASK卖出订单失败. %s", err)
+						p.logger.Errorf("创建ASK卖出订单失败. %s", err)
 					}
 				}()
+				wg.Wait()
+
+				// 同一账户的买卖订单互相成交，净持仓不变，下单返回后才成交的数量按挂单成交记录
+				washPrice := math.Abs(askPrice - cfg.ExpectDiffrentValue)
+				onFill := func(delta float64) {
+					p.recordWashRisk(cfg, askPrice, delta, true)
+					p.recordWashFill(cfg, BidOrderTypeName, washPrice, delta, true)
+					p.recordWashFill(cfg, AskOrderTypeName, washPrice, delta, true)
+				}
+				filled := p.recordFilled(askPrice, onFill, bidOrder, askOrder)
+				p.recordWashRisk(cfg, askPrice, filled, false)
+				p.recordWashPnl(cfg, washPrice, filled, bidOrder)
+				p.recordWashPnl(cfg, washPrice, filled, askOrder)
 			}(ecode)
 		}
 	}
@@ -473,106 +633,112 @@ func (p *Exchange) CancelOrders() {
 	for {
 		select {
 		case lock = <-p.cancelOrderLockChan:
+			p.Lock()
+			p.cancelOrderLocked = lock
+			p.Unlock()
 			if lock {
-				log.Logger.Infof("锁定自动撤单")
+				p.logger.Infof("锁定自动撤单")
 			} else {
-				log.Logger.Infof("解锁自动撤单")
+				p.logger.Infof("解锁自动撤单")
 			}
 		case orderType = <-p.cancelOrderChan:
-			if lock {
-				log.Logger.Infof("自动撤单已被锁定")
+			if !p.cancelAllowed(lock) {
+				break
+			}
+			go p.sweepOrders(orderType)
+		case done := <-p.cancelSweepChan:
+			// 定时撤单在检查结束后通知调度器，fixed_delay时下一次检查从本次结束后开始计时
+			if !p.cancelAllowed(lock) {
+				close(done)
 				break
 			}
+			go func() {
+				defer close(done)
+				p.sweepOrders(AllOrderType)
+			}()
+		}
+	}
+}
 
-			go func(otype int) {
-				var (
-					ot          int
-					err         error
-					start       int64
-					end         int64
-					dTime       int64
-					serverTime  int64
-					nonce       int64
-					cancelDtime = float64(p.config.CancelOrderDiffrentTime)
-					orders      *model.OrderListResponeBody
-
-					parms = map[string]string{
-						"market_id": p.symbolPair.UUID,
-						"first":     fmt.Sprintf("%d", p.config.CheckOrderNumber),
-					}
-					states []string = p.config.CancelOrderTypes
+// 是否可以自动撤单，lock为自动撤单锁定状态
+func (p *Exchange) cancelAllowed(lock bool) bool {
+	if lock {
+		p.logger.Infof("自动撤单已被锁定")
+		return false
+	}
 
-					tk = time.NewTicker(time.Duration(p.config.CancelOrderInterval) * time.Millisecond)
-				)
-				// 锁定交易
-				if p.config.CancelOrderLockExchange {
-					p.exchangeLockChan <- true
-					defer func() {
-						p.exchangeLockChan <- false
-					}()
-				}
+	p.RLock()
+	held := p.cancelHeld
+	p.RUnlock()
+	if held {
+		p.logger.Infof("自动撤单已被控制接口锁定")
+		return false
+	}
 
-				//
-				start = time.Now().UnixNano()
-				defer func() {
-					end = time.Now().UnixNano()
-					p.cancelOrderTimeChan <- end - start
-				}()
+	if open := p.b1client.OpenCircuits(); len(open) != 0 {
+		p.logger.Debugf("api熔断中，暂停自动撤单. %s", strings.Join(open, ", "))
+		return false
+	}
 
-				for _, state := range states {
-					log.Logger.Infof("开始检查 %s 状态订单", state)
-					nonce = time.Now().UnixNano()
-					parms["state"] = strings.ToUpper(state)
-					orders, err = p.b1client.GetOrders(nonce+1, parms)
-					if err != nil {
-						log.Logger.Errorf("获取订单列表失败. %s\n", err)
-						continue
-					}
+	return true
+}
 
-					serverTime, err = p.b1client.Ping()
-					if err != nil {
-						log.Logger.Errorf("获取交易所服务器时间失败. %s", err)
-						continue
-					}
+// 检查订单并撤销超时的订单
+func (p *Exchange) sweepOrders(otype int) {
+	var (
+		cfg        = p.conf()
+		err        error
+		start      int64
+		end        int64
+		serverTime int64
+		nonce      int64
+		orders     *model.OrderListResponeBody
+
+		parms = map[string]string{
+			"market_id": p.symbolPair.UUID,
+			"first":     fmt.Sprintf("%d", cfg.CheckOrderNumber),
+		}
+		states []string = cfg.CancelOrderTypes
 
-					for _, order := range orders.Data.Edges {
-						switch strings.ToUpper(order.Node.Side) {
-						case BidOrderTypeName:
-							ot = BidOrderType
-						case AskOrderTypeName:
-							ot = AskOrderType
-						}
+		tk = time.NewTicker(time.Duration(cfg.CancelOrderInterval) * time.Millisecond)
+	)
+	// 锁定交易
+	if cfg.CancelOrderLockExchange {
+		p.exchangeLockChan <- true
+		defer func() {
+			p.exchangeLockChan <- false
+		}()
+	}
 
-						switch otype {
-						case BidOrderType:
-							if ot != BidOrderType {
-								continue
-							}
-							break
-						case AskOrderType:
-							if ot != AskOrderType {
-								continue
-							}
-							break
-						default:
-							break
-						}
+	//
+	start = time.Now().UnixNano()
+	defer func() {
+		end = time.Now().UnixNano()
+		p.cancelOrderTimeChan <- end - start
+	}()
+
+	for _, state := range states {
+		p.logger.Infof("开始检查 %s 状态订单", state)
+		nonce = time.Now().UnixNano()
+		parms["state"] = strings.ToUpper(state)
+		orders, err = p.b1client.GetOrders(nonce+1, parms)
+		if err != nil {
+			p.logger.Errorf("获取订单列表失败. %s\n", err)
+			continue
+		}
 
-						dTime = (serverTime - order.Node.InsertedAt.UnixNano()) / 1000000
-						if math.Abs(float64(dTime)) > cancelDtime {
-							// cancel order
-							nonce = time.Now().UnixNano()
-							log.Logger.Infof("服务器当前时间大于订单 %s 创建时间%d毫秒，订单超时，开始取消", order.Node.Id, dTime)
-							_, err = p.b1client.CancelOrder(nonce, order.Node.Id)
-							if err != nil {
-								log.Logger.Infof("取消订单 %s 失败. %s", order.Node.Id, err)
-							}
-							<-tk.C
-						}
-					}
-				}
-			}(orderType)
+		if parms["state"] == model.OrderPendingState {
+			p.risk.setOpenOrders(p.countOpenOrders(cfg, parms, orders.Data))
+			p.enforceRisk(cfg)
+		}
+
+		serverTime, err = p.b1client.Ping()
+		if err != nil {
+			p.logger.Errorf("获取交易所服务器时间失败. %s", err)
+			continue
 		}
+
+		p.cancelStale(cfg, parms["state"], orders.Data, serverTime, otype, tk)
 	}
 }
 
@@ -582,25 +748,42 @@ func (p *Exchange) BalanceAccountBalance() {
 	for {
 		select {
 		case <-p.balanceChan:
-			log.Logger.Infof("开始平衡资产")
+			p.RLock()
+			held := p.balanceHeld
+			p.RUnlock()
+			if held {
+				p.logger.Infof("平衡资产已被控制接口锁定")
+				break
+			}
+
+			// 拆分执行平衡资产订单时在启动前标记，避免下一次平衡资产重复执行
+			cfg := p.conf()
+			split := cfg.RebalanceExecution.Mode != model.ExecutionDirect
+			if split && !p.beginExecution() {
+				p.logger.Infof("正在执行平衡资产订单")
+				break
+			}
+
+			p.logger.Infof("开始平衡资产")
 			go func() {
+				if split {
+					defer p.endExecution()
+				}
+
 				var (
 					err           error
 					start         int64
 					end           int64
-					nonce         int64
 					number        float64
 					bflag         int
 					qflag         int
 					code          int
 					askPrice      float64
 					bidPrice      float64
-					price         string
-					amount        string
 					currentTicker *model.MarketTickerResponeBody
 				)
 				// 锁定自动撤单
-				if p.config.BalanceLockCancelOrder {
+				if cfg.BalanceLockCancelOrder {
 					p.cancelOrderLockChan <- true
 					defer func() {
 						p.cancelOrderLockChan <- false
@@ -614,14 +797,25 @@ func (p *Exchange) BalanceAccountBalance() {
 					p.balanceTimeChan <- end - start
 				}()
 
-				// 这里使用获取账户信息时获取到的行情
-				if p.baseBalance > p.config.ExchangeAmount {
+				// 这里使用获取账户信息时获取到的资产和行情
+				p.RLock()
+				var (
+					baseBalance    = p.baseBalance
+					quoteBalance   = p.quoteBalance
+					baseAvailable  = p.baseAvaiable
+					quoteAvailable = p.quoteAvaiable
+					lastAsk        = p.askPrice
+					balancePercent = p.balancePercent
+				)
+				p.RUnlock()
+
+				if baseBalance > cfg.ExchangeAmount {
 					bflag = 20
 				} else {
 					bflag = 10
 				}
 
-				if p.quoteBalance > p.askPrice*p.config.ExchangeAmount {
+				if quoteBalance > lastAsk*cfg.ExchangeAmount {
 					qflag = 2
 				} else {
 					qflag = 1
@@ -629,42 +823,54 @@ func (p *Exchange) BalanceAccountBalance() {
 
 				code = bflag + qflag
 
+				// 按目标比例平衡，比例在容忍范围内时不再单边补充资产，资产不足时降低交易数量
+				if cfg.RebalanceTargetEnabled() {
+					if p.rebalanceToTarget(cfg) {
+						return
+					}
+					if code == 12 || code == 21 {
+						code = 11
+					}
+				}
+
 				// 平衡时在获取一次行情
 				switch code {
 				case 12:
 					// 补充base currency
-					log.Logger.Infof("账户 %s 总资产不足，准备平衡该资产", p.symbolPair.BaseAsset.Name)
-					number = p.askPrice * p.config.ExchangeAmount * p.balancePercent
+					p.logger.Infof("账户 %s 总资产不足，准备平衡该资产", p.symbolPair.BaseAsset.Name)
+					number = lastAsk * cfg.ExchangeAmount * balancePercent
 
-					if p.quoteAvaiable < number {
-						log.Logger.Infof("账户 %s 可用资产不足以平衡资产，尝试取消订单", p.symbolPair.QuoteAsset.Name)
+					if quoteAvailable < number {
+						p.logger.Infof("账户 %s 可用资产不足以平衡资产，尝试取消订单", p.symbolPair.QuoteAsset.Name)
 						p.cancelOrderChan <- AskOrderType
 						break
 					}
 
 					currentTicker, err = p.b1client.GetTicker(p.symbolPair.Name)
 					if err != nil {
-						log.Logger.Errorf("获取行情数据失败. %s", err)
+						p.logger.Errorf("获取行情数据失败. %s", err)
+						break
+					}
+
+					if !p.checkTicker(cfg, currentTicker) {
 						break
 					}
 
 					askPrice, err = strconv.ParseFloat(currentTicker.Data.Ask.Price, 10)
 					if err != nil {
-						log.Logger.Errorf("转换当前ask价格为float类型失败")
+						p.logger.Errorf("转换当前ask价格为float类型失败")
 						break
 					}
 
-					price = fmt.Sprintf(p.priceFormat, askPrice)
-					amount = fmt.Sprintf(p.amountFormat, p.config.ExchangeAmount*p.balancePercent)
-					nonce = time.Now().UnixNano()
-					_, err = p.Bid(nonce, p.symbolPair.UUID, price, amount)
-					log.Logger.Infof("平衡资产时创建BID买入订单price: %s, amount: %s", price, amount)
-					if err != nil {
-						log.Logger.Errorf("平衡资产时创建BID买入订单失败. %s", err)
+					if !p.allowRisk(cfg, BidOrderTypeName, cfg.ExchangeAmount*balancePercent, askPrice) {
+						break
 					}
+
+					p.placeRebalance(cfg, BidOrderTypeName, cfg.ExchangeAmount*balancePercent, askPrice,
+						touchPricer(BidOrderTypeName))
 				case 22:
-					log.Logger.Infof("账户总资产足够，取消订单来平衡账户")
-					if p.config.BalanceLockCancelOrder {
+					p.logger.Infof("账户总资产足够，取消订单来平衡账户")
+					if cfg.BalanceLockCancelOrder {
 						p.cancelOrderLockChan <- false
 					}
 					p.cancelOrderChan <- AllOrderType
@@ -673,40 +879,42 @@ func (p *Exchange) BalanceAccountBalance() {
 					break
 				case 21:
 					// 补充quote currency
-					log.Logger.Infof("账户 %s 总资产不足，准备平衡该资产", p.symbolPair.QuoteAsset.Name)
-					number = p.config.ExchangeAmount * p.balancePercent
-					if p.baseAvaiable < number {
-						log.Logger.Infof("账户 %s 可用资产不足以平衡资产,尝试取消订单", p.symbolPair.BaseAsset.Name)
+					p.logger.Infof("账户 %s 总资产不足，准备平衡该资产", p.symbolPair.QuoteAsset.Name)
+					number = cfg.ExchangeAmount * balancePercent
+					if baseAvailable < number {
+						p.logger.Infof("账户 %s 可用资产不足以平衡资产,尝试取消订单", p.symbolPair.BaseAsset.Name)
 						p.cancelOrderChan <- BidOrderType
 						break
 					}
 
 					currentTicker, err = p.b1client.GetTicker(p.symbolPair.Name)
 					if err != nil {
-						log.Logger.Errorf("获取行情数据失败. %s", err)
+						p.logger.Errorf("获取行情数据失败. %s", err)
+						break
+					}
+
+					if !p.checkTicker(cfg, currentTicker) {
 						break
 					}
 
 					bidPrice, err = strconv.ParseFloat(currentTicker.Data.Bid.Price, 10)
 					if err != nil {
-						log.Logger.Errorf("转换当前bid价格为float类型失败")
+						p.logger.Errorf("转换当前bid价格为float类型失败")
 						break
 					}
-					price = fmt.Sprintf(p.priceFormat, bidPrice)
-					amount = fmt.Sprintf(p.amountFormat, p.config.ExchangeAmount*p.balancePercent)
-					nonce = time.Now().UnixNano()
-					_, err = p.Ask(nonce, p.symbolPair.UUID, price, amount)
-					log.Logger.Infof("平衡资产时创建ASK卖出订单price: %s, amount: %s", price, amount)
-					if err != nil {
-						log.Logger.Errorf("平衡资产时创建ASK卖出订单失败. %s", err)
+					if !p.allowRisk(cfg, AskOrderTypeName, cfg.ExchangeAmount*balancePercent, bidPrice) {
+						break
 					}
 
+					p.placeRebalance(cfg, AskOrderTypeName, cfg.ExchangeAmount*balancePercent, bidPrice,
+						touchPricer(AskOrderTypeName))
+
 					break
 				case 11:
 					// 减小sell number
-					log.Logger.Infof("账户总资产不足，降低买卖数量%f 到 %f",
-						p.config.ExchangeAmount, p.config.ExchangeAmount*float64(p.config.BalanceExchangePercent)/100.0)
-					p.config.ExchangeAmount = p.config.ExchangeAmount * float64(p.config.BalanceExchangePercent) / 100.0
+					number = cfg.ExchangeAmount * float64(cfg.BalanceExchangePercent) / 100.0
+					p.logger.Infof("账户总资产不足，降低买卖数量%f 到 %f", cfg.ExchangeAmount, number)
+					p.setExchangeAmount(number)
 					break
 				}
 			}()
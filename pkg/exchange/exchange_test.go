@@ -0,0 +1,158 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/api"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	log.Logger = zap.NewNop().Sugar()
+	log.Audit = zap.NewNop().Sugar()
+	executionPollInterval = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// 测试使用的交易对，价格保留2位小数，数量保留4位小数
+func testSymbolPair() *model.SymbolPair {
+	return &model.SymbolPair{
+		UUID:       "btc-usdt",
+		Name:       "BTC-USDT",
+		BaseScale:  2,
+		QuoteScale: 4,
+		BaseAsset:  &model.Asset{UUID: "btc", Symbol: "BTC", Name: "BTC"},
+		QuoteAsset: &model.Asset{UUID: "usdt", Symbol: "USDT", Name: "USDT"},
+	}
+}
+
+// 创建测试使用的交易市场，client为空时不能请求接口
+func newTestExchange(cfg *model.Configuration, client *api.Client) *Exchange {
+	if cfg.Account == "" {
+		cfg.Account = "test"
+	}
+	if cfg.FeeModel == nil {
+		cfg.FeeModel = &model.FeeModelConfig{FeeAsset: model.FeeAssetReceived}
+	}
+	if cfg.PriceGuard == nil {
+		cfg.PriceGuard = &model.PriceGuardConfig{RecoverCount: 1}
+	}
+	return newExchange(cfg, client, testSymbolPair(), 0, newOrderRegistry(""), nil)
+}
+
+// 模拟交易所的行情和订单接口，下单、查询和撤单时调用对应的函数修改订单状态，
+// onCancel返回false时撤单失败，撤单成功时订单状态改为已取消
+type stubExchange struct {
+	sync.Mutex
+	*httptest.Server
+	ticker   *model.Ticker
+	orders   map[string]*model.Order
+	created  []*model.Order
+	cancels  int
+	onCreate func(o *model.Order)
+	onGet    func(o *model.Order)
+	onCancel func(o *model.Order) bool
+}
+
+func newStubExchange(t *testing.T) *stubExchange {
+	var s = &stubExchange{
+		ticker: testTicker("99", "5", "101", "5"),
+		orders: make(map[string]*model.Order),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubExchange) client() *api.Client {
+	return api.NewClient(s.URL, "key", "secret", 1000, 0)
+}
+
+func (s *stubExchange) serve(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	var (
+		data  interface{}
+		path  = strings.Trim(r.URL.Path, "/")
+		parts = strings.Split(path, "/")
+	)
+
+	switch {
+	case strings.HasSuffix(path, "/ticker"):
+		data = s.ticker
+	case r.Method == http.MethodPost && path == "viewer/orders":
+		q := r.URL.Query()
+		o := &model.Order{
+			Id:           strconv.Itoa(len(s.created) + 1),
+			MarketId:     q.Get("market_id"),
+			Side:         q.Get("side"),
+			Price:        q.Get("price"),
+			Amount:       q.Get("amount"),
+			FilledAmount: "0",
+			State:        model.OrderPendingState,
+		}
+		if s.onCreate != nil {
+			s.onCreate(o)
+		}
+		s.orders[o.Id] = o
+		s.created = append(s.created, o)
+		data = o
+	case len(parts) == 4 && parts[3] == "cancel":
+		o := s.orders[parts[2]]
+		s.cancels++
+		if o == nil || (s.onCancel != nil && !s.onCancel(o)) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []*model.ErrorMessage{{Code: 10014, Message: "cancel failed"}}})
+			return
+		}
+		o.State = "CANCELED"
+		data = o
+	case len(parts) == 3 && parts[1] == "orders" && s.orders[parts[2]] != nil:
+		o := s.orders[parts[2]]
+		if s.onGet != nil {
+			s.onGet(o)
+		}
+		data = o
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// 订单成交amount，按下单价格成交，全部成交时状态改为已成交
+func fillOrder(o *model.Order, amount float64) {
+	total, _ := strconv.ParseFloat(o.Amount, 10)
+	o.FilledAmount = strconv.FormatFloat(amount, 'f', -1, 64)
+	o.AvgDealPrice = o.Price
+	if amount >= total {
+		o.State = model.OrderFilledState
+	}
+}
+
+// 订单全部成交
+func fillAll(o *model.Order) {
+	total, _ := strconv.ParseFloat(o.Amount, 10)
+	fillOrder(o, total)
+}
+
+func (s *stubExchange) createdAmounts() []string {
+	s.Lock()
+	defer s.Unlock()
+	var amounts []string
+	for _, o := range s.created {
+		amounts = append(amounts, o.Amount)
+	}
+	return amounts
+}
@@ -0,0 +1,356 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/model"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询子订单成交情况的时间间隔
+var executionPollInterval = time.Second
+
+// 一次下单的平衡资产订单在下单返回后继续跟踪成交的时间间隔和最长时间
+const (
+	rebalanceTrackInterval = 5 * time.Second
+	rebalanceTrackTTL      = time.Hour
+)
+
+// 平衡资产订单执行结果，滑点为成交均价相对到达价格(开始执行时的中间价)的不利偏离百分比
+type ExecutionReport struct {
+	Mode         string    `json:"mode"`
+	Side         string    `json:"side"`
+	Amount       float64   `json:"amount"`
+	Filled       float64   `json:"filled"`
+	AvgPrice     float64   `json:"avg_price"`
+	ArrivalPrice float64   `json:"arrival_price"`
+	Slippage     float64   `json:"slippage_percent"`
+	Children     int       `json:"children"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+// 子订单价格，根据买一卖一价计算
+type childPricer func(bid, ask float64) float64
+
+// 按盘口价格下单，买单使用卖一价，卖单使用买一价
+func touchPricer(side string) childPricer {
+	return func(bid, ask float64) float64 {
+		if side == BidOrderTypeName {
+			return ask
+		}
+		return bid
+	}
+}
+
+// 在买一卖一价之间下单
+func (p *Exchange) insidePricer(side string, position float64) childPricer {
+	return func(bid, ask float64) float64 {
+		return p.insidePrice(side, bid, ask, position)
+	}
+}
+
+// 标记开始执行拆分的平衡资产订单，已经在执行时返回false
+func (p *Exchange) beginExecution() bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.executing {
+		return false
+	}
+	p.executing = true
+	return true
+}
+
+func (p *Exchange) endExecution() {
+	p.Lock()
+	p.executing = false
+	p.Unlock()
+}
+
+// 按配置的执行方式下平衡资产订单，direct时一次下单
+func (p *Exchange) placeRebalance(cfg *model.Configuration, side string, amount, price float64, pricer childPricer) {
+	if cfg.RebalanceExecution.Mode != model.ExecutionDirect {
+		p.execute(cfg, side, amount, pricer)
+		return
+	}
+
+	var (
+		err       error
+		order     *model.Order
+		nonce     = time.Now().UnixNano()
+		priceStr  = fmt.Sprintf(p.priceFormat, price)
+		amountStr = fmt.Sprintf(p.amountFormat, amount)
+	)
+
+	if side == BidOrderTypeName {
+		order, err = p.Bid(nonce, p.symbolPair.UUID, priceStr, amountStr)
+	} else {
+		order, err = p.Ask(nonce, p.symbolPair.UUID, priceStr, amountStr)
+	}
+	p.countOrder(side, metrics.PurposeBalance, err)
+	p.logger.Infof("平衡资产时创建%s订单price: %s, amount: %s", side, priceStr, amountStr)
+	if err != nil {
+		p.logger.Errorf("平衡资产时创建%s订单失败. %s", side, err)
+		return
+	}
+
+	p.recordRisk(cfg, metrics.PurposeBalance, price, order)
+
+	// 下单时已成交的数量为吃单成交，滑点相对当前中间价计算
+	p.RLock()
+	mid := (p.askPrice + p.bidPrice) / 2
+	p.RUnlock()
+	filled, _ := strconv.ParseFloat(order.FilledAmount, 10)
+	avg, err := strconv.ParseFloat(order.AvgDealPrice, 10)
+	if err != nil || avg <= 0 {
+		avg = price
+	}
+	p.recordRebalancePnl(cfg, side, filled, avg, mid, false)
+
+	if !orderDone(order) {
+		go p.trackRebalance(cfg, side, order, price, mid)
+	}
+}
+
+// 跟踪一次下单的平衡资产订单直到完全成交或取消，补记下单返回后的挂单成交，
+// 买入花费已在下单时按下单数量计入
+func (p *Exchange) trackRebalance(cfg *model.Configuration, side string, order *model.Order, price, reference float64) {
+	var (
+		deadline    = time.Now().Add(rebalanceTrackTTL)
+		recorded, _ = strconv.ParseFloat(order.FilledAmount, 10)
+	)
+
+	for !orderDone(order) && time.Now().Before(deadline) {
+		time.Sleep(rebalanceTrackInterval)
+		order = p.refreshOrder(order)
+
+		filled, _ := strconv.ParseFloat(order.FilledAmount, 10)
+		if filled <= recorded {
+			continue
+		}
+
+		avg, err := strconv.ParseFloat(order.AvgDealPrice, 10)
+		if err != nil || avg <= 0 {
+			avg = price
+		}
+
+		delta := filled - recorded
+		recorded = filled
+		p.risk.fill(side, delta, avg, cfg.FeeModel.Rate(true))
+		p.enforceRisk(cfg)
+		p.recordRebalancePnl(cfg, side, delta, avg, reference, true)
+	}
+}
+
+// 拆分平衡资产订单，twap在duration内分slices次下单，每个时段结束时未成交的数量并入下一个时段；
+// iceberg每次只挂出slice_amount，reprice_interval内没有完全成交时取消并按最新行情重新下单
+func (p *Exchange) execute(cfg *model.Configuration, side string, total float64, pricer childPricer) {
+	var (
+		ec       = cfg.RebalanceExecution
+		report   = &ExecutionReport{Mode: ec.Mode, Side: side, Amount: total, Start: time.Now()}
+		minimum  = math.Pow10(-p.symbolPair.QuoteScale)
+		cost     float64
+		reprices int
+		wait     time.Duration
+	)
+
+	defer func() {
+		p.Lock()
+		p.lastExecution = report
+		p.Unlock()
+	}()
+
+	if ec.Mode == model.ExecutionTWAP {
+		wait = time.Duration(ec.Duration/int64(ec.Slices)) * time.Millisecond
+	} else {
+		wait = time.Duration(ec.RepriceInterval) * time.Millisecond
+	}
+
+	p.logger.Infof("开始使用%s方式%s %f", ec.Mode, side, total)
+	for total-report.Filled >= minimum && reprices <= ec.MaxReprices {
+		if cfg.RiskEnabled() && p.risk.isHalted() {
+			break
+		}
+
+		ticker, err := p.b1client.GetTicker(p.symbolPair.Name)
+		if err != nil {
+			p.logger.Errorf("获取行情数据失败. %s", err)
+			break
+		}
+
+		if !p.checkTicker(cfg, ticker) {
+			break
+		}
+
+		askPrice, _ := strconv.ParseFloat(ticker.Data.Ask.Price, 10)
+		bidPrice, _ := strconv.ParseFloat(ticker.Data.Bid.Price, 10)
+		if report.ArrivalPrice == 0 {
+			report.ArrivalPrice = (askPrice + bidPrice) / 2
+		}
+
+		// twap按时段计划的累计数量下单，iceberg每次最多挂出slice_amount
+		var amount = total - report.Filled
+		if ec.Mode == model.ExecutionTWAP && report.Children < ec.Slices {
+			amount = total*float64(report.Children+1)/float64(ec.Slices) - report.Filled
+		}
+		if ec.Mode == model.ExecutionIceberg {
+			amount = math.Min(amount, ec.SliceAmount)
+		}
+
+		report.Children++
+		if amount < minimum {
+			time.Sleep(wait)
+			continue
+		}
+
+		price := pricer(bidPrice, askPrice)
+		filled, avg, ok := p.executeChild(cfg, side, amount, price, report.ArrivalPrice, wait)
+		report.Filled += filled
+		cost += filled * avg
+
+		// 子订单没有确认取消时可能仍在挂单，继续下单可能超过计划数量
+		if !ok {
+			p.logger.Errorf("子订单没有确认取消，停止%s方式%s", ec.Mode, side)
+			break
+		}
+
+		// twap计划时段内未成交的数量并入下一个时段，不计为重新下单
+		if filled < amount-minimum/2 && (ec.Mode != model.ExecutionTWAP || report.Children >= ec.Slices) {
+			reprices++
+		}
+	}
+
+	report.End = time.Now()
+	if report.Filled > 0 {
+		report.AvgPrice = cost / report.Filled
+	}
+	if report.Filled > 0 && report.ArrivalPrice > 0 {
+		report.Slippage = (report.AvgPrice - report.ArrivalPrice) * 100 / report.ArrivalPrice
+		if side == AskOrderTypeName {
+			report.Slippage = -report.Slippage
+		}
+	}
+
+	p.logger.Infof("%s方式%s完成, 计划数量 %f, 成交数量 %f, 子订单 %d 个, 成交均价 %f, 到达价格 %f, 滑点 %.4f%%",
+		ec.Mode, side, total, report.Filled, report.Children, report.AvgPrice, report.ArrivalPrice, report.Slippage)
+}
+
+// 下一个子订单并等待成交，超时未完全成交时取消，返回成交数量和成交均价，
+// 子订单没有确认取消时ok为false。arrival为开始执行时的中间价，用于计算滑点
+func (p *Exchange) executeChild(cfg *model.Configuration, side string, amount, price, arrival float64, wait time.Duration) (filled, avg float64, ok bool) {
+	if !p.allowRisk(cfg, side, amount, price) {
+		time.Sleep(wait)
+		return 0, 0, true
+	}
+
+	var (
+		err       error
+		order     *model.Order
+		nonce     = time.Now().UnixNano()
+		priceStr  = fmt.Sprintf(p.priceFormat, price)
+		amountStr = fmt.Sprintf(p.amountFormat, amount)
+		deadline  = time.Now().Add(wait)
+	)
+
+	if side == BidOrderTypeName {
+		order, err = p.Bid(nonce, p.symbolPair.UUID, priceStr, amountStr)
+	} else {
+		order, err = p.Ask(nonce, p.symbolPair.UUID, priceStr, amountStr)
+	}
+	p.countOrder(side, metrics.PurposeBalance, err)
+	p.logger.Infof("平衡资产时创建%s子订单price: %s, amount: %s", side, priceStr, amountStr)
+	if err != nil {
+		p.logger.Errorf("平衡资产时创建%s子订单失败. %s", side, err)
+		time.Sleep(wait)
+		return 0, 0, true
+	}
+
+	// 下单时已成交的数量为吃单成交，之后成交的数量为挂单成交
+	taker, _ := strconv.ParseFloat(order.FilledAmount, 10)
+
+	for time.Now().Before(deadline) && !orderDone(order) {
+		time.Sleep(executionPollInterval)
+		order = p.refreshOrder(order)
+	}
+
+	ok = true
+	if !orderDone(order) {
+		p.logger.Infof("子订单 %s 在 %d 毫秒内没有完全成交，取消后重新下单", order.Id, wait/time.Millisecond)
+		order, ok = p.cancelChild(side, order, wait)
+	}
+
+	filled, _ = strconv.ParseFloat(order.FilledAmount, 10)
+	avg, err = strconv.ParseFloat(order.AvgDealPrice, 10)
+	if err != nil || avg <= 0 {
+		avg = price
+	}
+
+	p.recordExecutionFill(cfg, side, filled, avg)
+	taker = math.Min(taker, filled)
+	p.recordRebalancePnl(cfg, side, taker, avg, arrival, false)
+	p.recordRebalancePnl(cfg, side, filled-taker, avg, arrival, true)
+	return filled, avg, ok
+}
+
+// 查询订单的最新状态，查询失败或没有返回订单时保留原来的订单
+func (p *Exchange) refreshOrder(order *model.Order) *model.Order {
+	o, err := p.b1client.GetOrder(time.Now().UnixNano(), order.Id)
+	if err != nil {
+		p.logger.Errorf("查询订单 %s 失败. %s", order.Id, err)
+		return order
+	}
+	if o == nil {
+		return order
+	}
+	return o
+}
+
+// 取消子订单并等待订单进入最终状态，撤单失败时重试，超过wait仍没有确认取消时返回false
+func (p *Exchange) cancelChild(side string, order *model.Order, wait time.Duration) (*model.Order, bool) {
+	var (
+		deadline = time.Now().Add(wait)
+		canceled bool
+	)
+
+	for {
+		if !canceled {
+			_, err := p.b1client.CancelOrder(time.Now().UnixNano(), order.Id)
+			p.countCancel(side, err)
+			if err != nil {
+				p.logger.Errorf("取消子订单 %s 失败. %s", order.Id, err)
+			}
+			canceled = err == nil
+		}
+
+		order = p.refreshOrder(order)
+		if orderDone(order) {
+			return order, true
+		}
+		if !time.Now().Before(deadline) {
+			return order, false
+		}
+		time.Sleep(executionPollInterval)
+	}
+}
+
+// 订单是否已完全成交或已取消
+func orderDone(order *model.Order) bool {
+	state := strings.ToUpper(order.State)
+	return state == model.OrderFilledState || state == model.OrderCanceledState || state == "CANCELED"
+}
+
+// 记录子订单的成交，买入花费按成交金额计算
+func (p *Exchange) recordExecutionFill(cfg *model.Configuration, side string, filled, price float64) {
+	if filled <= 0 {
+		return
+	}
+
+	p.risk.fill(side, filled, price, cfg.FeeModel.Rate(false))
+	if side == BidOrderTypeName {
+		p.risk.spend(filled * price)
+	}
+	p.enforceRisk(cfg)
+}
@@ -0,0 +1,174 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newExecutionConfig(ec *model.RebalanceExecutionConfig) *model.Configuration {
+	return &model.Configuration{RebalanceExecution: ec}
+}
+
+func TestExecuteTWAPCarryOver(t *testing.T) {
+	var (
+		stub = newStubExchange(t)
+		cfg  = newExecutionConfig(&model.RebalanceExecutionConfig{Mode: model.ExecutionTWAP, Slices: 3, Duration: 60})
+		p    = newTestExchange(cfg, stub.client())
+	)
+
+	// 第一个时段只成交一半，之后的时段全部成交
+	stub.onCreate = func(o *model.Order) {
+		if o.Id != "1" {
+			fillAll(o)
+		}
+	}
+	stub.onGet = func(o *model.Order) {
+		if o.Id == "1" {
+			fillOrder(o, 0.5)
+		}
+	}
+
+	p.execute(cfg, BidOrderTypeName, 3, touchPricer(BidOrderTypeName))
+
+	// 未成交的0.5并入第二个时段，最后一个时段按剩余数量下单
+	if amounts := stub.createdAmounts(); !reflect.DeepEqual(amounts, []string{"1.0000", "1.5000", "1.0000"}) {
+		t.Errorf("子订单数量 %v, 应为 1 1.5 1", amounts)
+	}
+
+	r := p.lastExecution
+	if r.Children != 3 || !floatEqual(r.Filled, 3) || r.AvgPrice != 101 || r.ArrivalPrice != 100 {
+		t.Errorf("执行结果 %+v, 应为3个子订单按101成交3", r)
+	}
+	if stub.cancels != 1 {
+		t.Errorf("撤单 %d 次, 应只取消第一个子订单", stub.cancels)
+	}
+}
+
+func TestExecuteIcebergMaxReprices(t *testing.T) {
+	var (
+		stub = newStubExchange(t)
+		cfg  = newExecutionConfig(&model.RebalanceExecutionConfig{Mode: model.ExecutionIceberg, SliceAmount: 1,
+			RepriceInterval: 20, MaxReprices: 1})
+		p = newTestExchange(cfg, stub.client())
+	)
+
+	// 子订单都没有成交，重新下单max_reprices次后停止
+	p.execute(cfg, AskOrderTypeName, 3, touchPricer(AskOrderTypeName))
+
+	if amounts := stub.createdAmounts(); !reflect.DeepEqual(amounts, []string{"1.0000", "1.0000"}) {
+		t.Errorf("子订单数量 %v, 应为2个1", amounts)
+	}
+	if r := p.lastExecution; r.Children != 2 || r.Filled != 0 || r.AvgPrice != 0 || r.Slippage != 0 {
+		t.Errorf("执行结果 %+v, 应为2个子订单没有成交", r)
+	}
+	if stub.cancels != 2 {
+		t.Errorf("撤单 %d 次, 应为2次", stub.cancels)
+	}
+}
+
+func TestExecuteStopsWhenNotCanceled(t *testing.T) {
+	var (
+		stub = newStubExchange(t)
+		cfg  = newExecutionConfig(&model.RebalanceExecutionConfig{Mode: model.ExecutionIceberg, SliceAmount: 1,
+			RepriceInterval: 20, MaxReprices: 5})
+		p = newTestExchange(cfg, stub.client())
+	)
+
+	// 子订单部分成交后撤单一直失败，订单可能仍在挂单，不再继续下单
+	stub.onGet = func(o *model.Order) { fillOrder(o, 0.3) }
+	stub.onCancel = func(o *model.Order) bool { return false }
+
+	p.execute(cfg, BidOrderTypeName, 3, touchPricer(BidOrderTypeName))
+
+	if n := len(stub.createdAmounts()); n != 1 {
+		t.Errorf("创建了 %d 个子订单, 应为1个", n)
+	}
+	if r := p.lastExecution; r.Children != 1 || !floatEqual(r.Filled, 0.3) {
+		t.Errorf("执行结果 %+v, 应记录第一个子订单的成交", r)
+	}
+	if stub.cancels < 2 {
+		t.Errorf("撤单失败时应重试, 撤单 %d 次", stub.cancels)
+	}
+}
+
+func TestExecuteSlippage(t *testing.T) {
+	for _, c := range []struct {
+		side     string
+		price    string
+		slippage float64
+	}{
+		// 滑点为相对到达价格100的不利偏离
+		{side: BidOrderTypeName, price: "102", slippage: 2},
+		{side: BidOrderTypeName, price: "99", slippage: -1},
+		{side: AskOrderTypeName, price: "98", slippage: 2},
+		{side: AskOrderTypeName, price: "101", slippage: -1},
+	} {
+		var (
+			stub = newStubExchange(t)
+			cfg  = newExecutionConfig(&model.RebalanceExecutionConfig{Mode: model.ExecutionIceberg, SliceAmount: 5,
+				RepriceInterval: 20})
+			p = newTestExchange(cfg, stub.client())
+		)
+		stub.onCreate = func(o *model.Order) {
+			fillOrder(o, 2)
+			o.AvgDealPrice = c.price
+		}
+
+		p.execute(cfg, c.side, 2, touchPricer(c.side))
+		if r := p.lastExecution; !floatEqual(r.Slippage, c.slippage) || r.Children != 1 {
+			t.Errorf("%s 成交价 %s: 执行结果 %+v, 滑点应为 %f%%", c.side, c.price, r, c.slippage)
+		}
+	}
+}
+
+func TestExecuteChild(t *testing.T) {
+	var (
+		stub = newStubExchange(t)
+		cfg  = newExecutionConfig(&model.RebalanceExecutionConfig{Mode: model.ExecutionIceberg})
+		p    = newTestExchange(cfg, stub.client())
+	)
+
+	// 下单时成交0.4，之后挂单成交到1后取消
+	stub.onCreate = func(o *model.Order) { fillOrder(o, 0.4) }
+	stub.onGet = func(o *model.Order) { fillOrder(o, 1) }
+
+	filled, avg, ok := p.executeChild(cfg, BidOrderTypeName, 2, 100.5, 100, 20*time.Millisecond)
+	if !ok || filled != 1 || avg != 100.5 {
+		t.Errorf("子订单结果 %f %f %v, 应为 1 100.5 true", filled, avg, ok)
+	}
+	if s := p.risk.Status(); s.Position != 1 || s.RebalanceQuoteDaily != 100.5 {
+		t.Errorf("风险控制统计 %+v, 应记录买入1", s)
+	}
+}
+
+func TestCancelChild(t *testing.T) {
+	var (
+		stub  = newStubExchange(t)
+		p     = newTestExchange(newExecutionConfig(nil), stub.client())
+		order = &model.Order{Id: "1", State: model.OrderPendingState}
+	)
+	stub.orders["1"] = &model.Order{Id: "1", Amount: "1", State: model.OrderPendingState}
+
+	// 第一次撤单失败时重试
+	var calls int
+	stub.onCancel = func(o *model.Order) bool {
+		calls++
+		return calls > 1
+	}
+	if o, ok := p.cancelChild(BidOrderTypeName, order, time.Second); !ok || !orderDone(o) || stub.cancels != 2 {
+		t.Errorf("撤单结果 %+v %v, 撤单 %d 次, 应在第二次撤单后确认取消", o, ok, stub.cancels)
+	}
+
+	// 超过等待时间仍没有确认取消
+	stub.orders["2"] = &model.Order{Id: "2", Amount: "1", State: model.OrderPendingState}
+	stub.onCancel = func(o *model.Order) bool { return false }
+	start := time.Now()
+	if o, ok := p.cancelChild(BidOrderTypeName, &model.Order{Id: "2"}, 20*time.Millisecond); ok || orderDone(o) {
+		t.Errorf("撤单结果 %+v %v, 应没有确认取消", o, ok)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("等待 %v 后返回, 应等待到超时", elapsed)
+	}
+}
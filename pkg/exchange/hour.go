@@ -0,0 +1,91 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"time"
+)
+
+const (
+	// 与交易所同步时间的间隔
+	clockSyncInterval = 10 * time.Minute
+
+	// 检查是否进入新的小时的间隔
+	hourCheckInterval = time.Second
+)
+
+// 通过Ping获取交易所服务器时间，计算与本地时间的偏差，取请求往返的中点作为本地时间
+func (p *limitationChecker) syncClock() {
+	start := time.Now()
+	ts, err := p.b1client.Ping()
+	end := time.Now()
+	if err != nil {
+		log.Logger.Errorf("获取交易所服务器时间失败. %s", err)
+		return
+	}
+
+	offset := time.Unix(0, ts).Sub(start.Add(end.Sub(start) / 2))
+
+	p.Lock()
+	p.clockOffset = offset
+	p.clockSynced = end
+	p.Unlock()
+
+	log.Logger.Debugf("本地时间与交易所服务器时间相差%d毫秒", offset/time.Millisecond)
+}
+
+// 按交易所服务器时间计算的当前时间
+func (p *limitationChecker) serverNow() time.Time {
+	p.RLock()
+	defer p.RUnlock()
+	return time.Now().Add(p.clockOffset)
+}
+
+// 统计数据所属的小时，statTime为交易所时区(+0800)的时间
+func statHour(stat *model.OneHourlyLimitationResponeBody) (time.Time, bool) {
+	if stat == nil || stat.Data == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(statTimeLayout, stat.Data.StatTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t.Truncate(time.Hour), true
+}
+
+// 检查是否进入新的小时，进入新的小时后恢复挖矿。
+// 休眠或长时间阻塞错过多个整点时只重置一次
+func (p *limitationChecker) checkHour() {
+	hour := p.serverNow().Truncate(time.Hour)
+
+	p.Lock()
+	last := p.resetHour
+	if !hour.After(last) {
+		p.Unlock()
+		return
+	}
+	p.resetHour = hour
+	p.lastReset = time.Now()
+	p.predictStopped = false
+	p.Unlock()
+
+	if missed := int(hour.Sub(last)/time.Hour) - 1; !last.IsZero() && missed > 0 {
+		log.Logger.Infof("错过了%d个整点重置，可能是系统休眠或时间调整", missed)
+	}
+
+	log.Logger.Infof("交易所时间进入新的小时 %s，恢复挖矿", hour.Format(statTimeLayout))
+	p.checkLimitationChan <- KeepRunningType
+}
+
+// 下一次整点重置的本地时间
+func (p *limitationChecker) nextReset() time.Time {
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.resetHour.IsZero() {
+		return time.Time{}
+	}
+	return p.resetHour.Add(time.Hour).Add(-p.clockOffset)
+}
@@ -0,0 +1,189 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/api"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
+	"sync"
+	"time"
+)
+
+// 挖矿限量检查，挖矿限量为交易所全站数据，所有账户和交易市场共享
+type limitationChecker struct {
+	b1client *api.Client
+	config   *model.Configuration
+	sync.RWMutex
+
+	limitation  float64
+	stat        *model.OneHourlyLimitationResponeBody
+	keepRunning bool
+	checked     bool
+	exchanges   []*Exchange
+
+	// 交易所服务器时间与本地时间的偏差，以及按服务器时间最近一次整点重置的小时
+	clockOffset time.Duration
+	clockSynced time.Time
+	resetHour   time.Time
+	lastReset   time.Time
+
+	// 当前小时挖矿速度估算
+	lastSample       *minedSample
+	minedRate        float64
+	projectedPercent float64
+	// 预测停止挖矿后保持停止，直到进入新的小时，避免同一小时内已挖矿量不再增加时恢复挖矿
+	predictStopped bool
+
+	checkLimitationChan chan int // 检查挖矿限量管道
+	checkEntry          *scheduler.Entry
+}
+
+// 创建挖矿限量检查，client只调用公共接口，不需要api凭证
+func newLimitationChecker(cfg *model.Configuration, client *api.Client) (*limitationChecker, error) {
+	lmt, err := client.OneLimitation()
+	if err != nil {
+		log.Logger.Infof("获取限额失败\n")
+		return nil, err
+	}
+
+	limitation := lmt.Data / 24.0
+	log.Logger.Infof("当前每小时限额：%f\n", limitation)
+
+	return &limitationChecker{
+		b1client:            client,
+		config:              cfg,
+		limitation:          limitation,
+		stat:                new(model.OneHourlyLimitationResponeBody),
+		keepRunning:         true,
+		checkLimitationChan: make(chan int, 1),
+	}, nil
+}
+
+// 每小时限额
+func (p *limitationChecker) Limitation() float64 {
+	return p.limitation
+}
+
+// 获取当前生效的配置
+func (p *limitationChecker) conf() *model.Configuration {
+	p.RLock()
+	defer p.RUnlock()
+	return p.config
+}
+
+// 注册需要接收限量检查结果的交易市场，已经检查过时立即同步一次结果
+func (p *limitationChecker) Register(exs ...*Exchange) {
+	p.Lock()
+	p.exchanges = append(p.exchanges, exs...)
+	stat, keepRunning, checked := p.stat, p.keepRunning, p.checked
+	p.Unlock()
+
+	if checked {
+		for _, ex := range exs {
+			ex.updateLimitation(stat, keepRunning, false)
+		}
+	}
+}
+
+// 检查挖矿限量，并通知所有交易市场
+func (p *limitationChecker) CheckOneLimitation() {
+	var (
+		stat        *model.OneHourlyLimitationResponeBody
+		err         error
+		sign        int
+		keepRunning = true
+	)
+
+	for {
+		select {
+		case sign = <-p.checkLimitationChan:
+			p.RLock()
+			synced := p.clockSynced
+			p.RUnlock()
+			if time.Since(synced) > clockSyncInterval {
+				p.syncClock()
+			}
+
+			stat, err = p.b1client.OneHourlyStatistic()
+			if err != nil {
+				log.Logger.Infof("检查系统当前小时挖矿量失败，%s,将使用上一次获取结果进行检查\n", err)
+				p.RLock()
+				stat = p.stat
+				p.RUnlock()
+			}
+
+			// 统计数据已进入新的小时说明本地估算的交易所时间落后，以统计时间为准
+			current := p.serverNow().Truncate(time.Hour)
+			hour, ok := statHour(stat)
+			if ok && hour.After(current) {
+				p.Lock()
+				if hour.After(p.resetHour) {
+					p.resetHour = hour
+					p.lastReset = time.Now()
+					p.predictStopped = false
+				}
+				p.Unlock()
+				current = hour
+			}
+
+			switch {
+			case ok && hour.Before(current):
+				// 整点后交易所统计数据还没有更新，上一个小时的数据不能用于判断当前小时的限额
+				log.Logger.Infof("统计时间 %s 属于上一个小时，按新的小时恢复挖矿", stat.Data.StatTime)
+				keepRunning = true
+			case stat != nil && stat.Data != nil:
+				log.Logger.Infof("当前每小时挖矿奖励: %f, 当前每小时邀请奖励: %f \n", stat.Data.TradeMineOne, stat.Data.InviteMineOne)
+				pct := (stat.Data.TradeMineOne + stat.Data.InviteMineOne) * 100.0 / p.limitation
+				log.Logger.Infof("当前小时已挖矿量占限额比例: %2.2f%%", pct)
+				cfg := p.conf()
+				if pct >= float64(cfg.OneHourlyLimitationPercent) {
+					log.Logger.Infof("当前小时已挖矿量已超限额的%d%%，设置停止挖矿", cfg.OneHourlyLimitationPercent)
+					keepRunning = false
+				} else {
+					keepRunning = !p.predictStop(stat, cfg)
+				}
+			case sign == KeepRunningType:
+				log.Logger.Debugf("收到keepRunning信号")
+				keepRunning = true
+			}
+
+			log.Logger.Debugf("将要设置keepRunging为%v\n", keepRunning)
+			p.Lock()
+			p.stat = stat
+			p.keepRunning = keepRunning
+			p.checked = true
+			exchanges := p.exchanges
+			p.Unlock()
+
+			for _, ex := range exchanges {
+				ex.updateLimitation(stat, keepRunning, sign == CheckLimitationType)
+			}
+		}
+	}
+}
+
+// 启动挖矿限量检查服务
+func (p *limitationChecker) Start(t *scheduler.Scheduler) {
+	log.Logger.Infof("启动检查挖矿限量服务")
+	go p.CheckOneLimitation()
+
+	// 以交易所服务器时间确定当前小时，启动时的限额检查结果属于当前小时
+	p.syncClock()
+	now := p.serverNow()
+	p.Lock()
+	p.resetHour = now.Truncate(time.Hour)
+	p.Unlock()
+
+	// 先检查检查一下限额
+	p.checkLimitationChan <- CheckLimitationType
+	log.Logger.Debugf("到下一个小时还有%d秒\n", int64(p.nextReset().Sub(time.Now())/time.Second))
+
+	cfg := p.conf()
+	entry := t.Add(newRunCheckLimitation(p.checkLimitationChan, CheckLimitationType),
+		time.Duration(cfg.CheckLimitationInterval)*time.Millisecond, cfg.ScheduleMode(model.ScheduleCheckLimitation))
+	p.Lock()
+	p.checkEntry = entry
+	p.Unlock()
+	// 按交易所服务器时间检查是否进入新的小时
+	t.Add(newRunHourCheck(p), hourCheckInterval, scheduler.FixedRate)
+}
@@ -0,0 +1,116 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/api"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 单个账户的多市场交易管理，账户下所有市场共用api客户端和请求限速
+type Manager struct {
+	name      string
+	b1client  *api.Client
+	config    *model.Configuration
+	exchanges []*Exchange
+	markets   map[string]*model.SymbolPair
+	owned     *orderRegistry
+	logger    *zap.SugaredLogger
+}
+
+// 创建账户的交易客户端，每个交易市场一个Exchange
+func newManager(cfg *model.Configuration, checker *limitationChecker) (*Manager, error) {
+	client := api.NewClient(cfg.EndPoint, cfg.AppKey, cfg.AppSecret, cfg.RequestTimeout, cfg.RequestRateLimit)
+	client.SetCircuitBreaker(cfg.Account, cfg.CircuitBreaker)
+	markets, err := client.GetAllMarkets()
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查api凭证是否有效
+	_, err = client.GetAccounts(time.Now().UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("验证账户api凭证失败. %s", err)
+	}
+
+	var mmap = make(map[string]*model.SymbolPair)
+	for _, p := range markets.Data {
+		mmap[p.Name] = p
+	}
+
+	var (
+		exchanges []*Exchange
+		owned     = newOrderRegistry(cfg.OwnedOrdersFile)
+		share     *accountShare
+	)
+	if cfg.ShareTrackEnable {
+		share = newAccountShare(cfg.ShareHistoryFile)
+	}
+	for _, mcfg := range cfg.MarketConfigs() {
+		pair := strings.ToUpper(mcfg.SymbolPair)
+		sp, exist := mmap[pair]
+		if !exist {
+			return nil, fmt.Errorf("交易对 %s 不存在", pair)
+		}
+		exchanges = append(exchanges, newExchange(mcfg, client, sp, checker.Limitation(), owned, share))
+	}
+
+	return &Manager{
+		name:      cfg.Account,
+		b1client:  client,
+		config:    cfg,
+		exchanges: exchanges,
+		markets:   mmap,
+		owned:     owned,
+		logger:    log.Logger.With("account", cfg.Account),
+	}, nil
+}
+
+// 启动账户下所有交易市场
+func (p *Manager) Start(t *scheduler.Scheduler) {
+	p.logger.Infof("启动账户交易服务")
+	for _, ex := range p.exchanges {
+		ex.Start(t)
+	}
+}
+
+// 创建不启动自动交易的交易市场，只用于使用该账户下单，不统计挖矿份额
+func (p *Manager) newLeg(cfg *model.Configuration, limitation float64) (*Exchange, error) {
+	sp, exist := p.markets[cfg.SymbolPair]
+	if !exist {
+		return nil, fmt.Errorf("交易对 %s 不存在", cfg.SymbolPair)
+	}
+	return newExchange(cfg, p.b1client, sp, limitation, p.owned, nil), nil
+}
+
+// 根据market参数查找交易市场，未指定时返回第一个市场，没有交易市场或找不到时返回nil
+func (p *Manager) exchange(market string) *Exchange {
+	if market == "" {
+		if len(p.exchanges) == 0 {
+			return nil
+		}
+		return p.exchanges[0]
+	}
+
+	for _, ex := range p.exchanges {
+		if ex.symbolPair.Name == strings.ToUpper(market) {
+			return ex
+		}
+	}
+
+	return nil
+}
+
+// 输出账户下所有交易市场的状态
+func (p *Manager) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	for _, ex := range p.exchanges {
+		resp.Write([]byte(fmt.Sprintf("[%s/%s]", p.name, ex.symbolPair.Name)))
+		ex.ServeHTTP(resp, req)
+	}
+}
@@ -0,0 +1,54 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/metrics"
+	"time"
+)
+
+// 记录操作耗时，d单位为纳秒
+func (p *Exchange) observeDuration(operation string, d int64) {
+	metrics.OperationDuration.WithLabelValues(p.conf().Account, p.symbolPair.Name, operation).
+		Observe(time.Duration(d).Seconds())
+}
+
+// 记录下单结果
+func (p *Exchange) countOrder(side, purpose string, err error) {
+	var result = "created"
+	if err != nil {
+		result = "failed"
+	}
+	metrics.Orders.WithLabelValues(p.conf().Account, p.symbolPair.Name, side, purpose, result).Inc()
+}
+
+// 记录撤单结果
+func (p *Exchange) countCancel(side string, err error) {
+	var result = "cancelled"
+	if err != nil {
+		result = "cancel_failed"
+	}
+	metrics.Orders.WithLabelValues(p.conf().Account, p.symbolPair.Name, side, metrics.PurposeStale, result).Inc()
+}
+
+// 更新资产和差价
+func (p *Exchange) updateBalanceMetrics() {
+	var (
+		account = p.conf().Account
+		market  = p.symbolPair.Name
+		base    = p.symbolPair.BaseAsset.Symbol
+		quote   = p.symbolPair.QuoteAsset.Symbol
+	)
+
+	p.RLock()
+	defer p.RUnlock()
+
+	metrics.Balance.WithLabelValues(account, market, base, "total").Set(p.baseBalance)
+	metrics.Balance.WithLabelValues(account, market, base, "available").Set(p.baseAvaiable)
+	metrics.Balance.WithLabelValues(account, market, quote, "total").Set(p.quoteBalance)
+	metrics.Balance.WithLabelValues(account, market, quote, "available").Set(p.quoteAvaiable)
+	metrics.Spread.WithLabelValues(account, market).Set(p.askPrice - p.bidPrice)
+}
+
+// 更新已挖矿百分比
+func (p *Exchange) updateMinedMetrics(minedPercent float64) {
+	metrics.MinedPercent.WithLabelValues(p.conf().Account, p.symbolPair.Name).Set(minedPercent)
+}
@@ -0,0 +1,247 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 记录机器人创建的订单的保留时间，超过后不再认为是机器人的订单
+const ownedOrderTTL = 24 * time.Hour
+
+// 清理过期记录并整理文件的时间间隔
+const ownedExpireInterval = time.Hour
+
+// 机器人订单记录，id为创建成功的订单，signature为没有收到响应的下单请求
+type ownedOrder struct {
+	Id        string    `json:"id,omitempty"`
+	Signature string    `json:"signature,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// 机器人创建的订单，同一账户的所有交易市场共享，撤单时用于区分手动下的订单。
+// BigONE下单接口不支持自定义订单标记，因此使用订单id识别；
+// 下单请求失败时(如请求超时)订单可能已经创建但没有返回订单id，此时记录交易对、方向、价格和数量作为订单签名。
+// 设置了file时追加写入文件，重启后仍然可以识别重启前创建的订单，
+// 每隔ownedExpireInterval清理一次过期记录并整理文件
+type orderRegistry struct {
+	sync.Mutex
+	file       string
+	f          *os.File
+	orders     map[string]time.Time
+	signatures map[string]time.Time
+	expired    time.Time
+}
+
+func newOrderRegistry(file string) *orderRegistry {
+	var p = &orderRegistry{
+		file:       file,
+		orders:     make(map[string]time.Time),
+		signatures: make(map[string]time.Time),
+		expired:    time.Now(),
+	}
+
+	if file == "" {
+		return p
+	}
+
+	if err := p.load(); err != nil {
+		log.Logger.Errorf("加载机器人订单记录失败. %s", err)
+	}
+
+	// 只保留未过期的记录，避免文件无限增长
+	if err := p.compact(); err != nil {
+		log.Logger.Errorf("整理机器人订单记录失败. %s", err)
+	}
+
+	return p
+}
+
+// 订单签名，价格和数量去掉末尾的0，与订单列表返回的格式无关
+func orderSignature(market, side, price, amount string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", market, strings.ToUpper(side), normalizeNumber(price), normalizeNumber(amount))
+}
+
+func normalizeNumber(v string) string {
+	f, err := strconv.ParseFloat(v, 10)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// 从文件加载记录，每行一条json记录
+func (p *orderRegistry) load() error {
+	f, err := os.Open(p.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var now = time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r = new(ownedOrder)
+		if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return fmt.Errorf("解析记录失败. %s, data: %s", err, scanner.Text())
+		}
+		if now.Sub(r.Time) > ownedOrderTTL {
+			continue
+		}
+		if r.Id != "" {
+			p.orders[r.Id] = r.Time
+		}
+		if r.Signature != "" {
+			p.signatures[r.Signature] = r.Time
+		}
+	}
+
+	return scanner.Err()
+}
+
+// 使用未过期的记录重写文件，重写后重新打开文件用于追加记录
+func (p *orderRegistry) compact() error {
+	if p.f != nil {
+		p.f.Close()
+		p.f = nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(p.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := p.file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for id, t := range p.orders {
+		data, _ := json.Marshal(&ownedOrder{Id: id, Time: t})
+		w.Write(append(data, '\n'))
+	}
+	for s, t := range p.signatures {
+		data, _ := json.Marshal(&ownedOrder{Signature: s, Time: t})
+		w.Write(append(data, '\n'))
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, p.file); err != nil {
+		return err
+	}
+
+	p.f, err = os.OpenFile(p.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+// 追加一条记录到文件，文件打开失败时重新打开
+func (p *orderRegistry) persist(r *ownedOrder) {
+	if p.file == "" {
+		return
+	}
+
+	if p.f == nil {
+		f, err := os.OpenFile(p.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Logger.Errorf("保存机器人订单记录失败. %s", err)
+			return
+		}
+		p.f = f
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Logger.Errorf("保存机器人订单记录失败. %s", err)
+		return
+	}
+
+	if _, err = p.f.Write(append(data, '\n')); err != nil {
+		log.Logger.Errorf("保存机器人订单记录失败. %s", err)
+	}
+}
+
+// 距离上一次清理超过ownedExpireInterval时清理过期记录并整理文件
+func (p *orderRegistry) expireIfDue(now time.Time) {
+	if now.Sub(p.expired) < ownedExpireInterval {
+		return
+	}
+	p.expired = now
+	p.expire(now)
+
+	if p.file == "" {
+		return
+	}
+	if err := p.compact(); err != nil {
+		log.Logger.Errorf("整理机器人订单记录失败. %s", err)
+	}
+}
+
+// 清理超过保留时间的记录
+func (p *orderRegistry) expire(now time.Time) {
+	for k, t := range p.orders {
+		if now.Sub(t) > ownedOrderTTL {
+			delete(p.orders, k)
+		}
+	}
+	for k, t := range p.signatures {
+		if now.Sub(t) > ownedOrderTTL {
+			delete(p.signatures, k)
+		}
+	}
+}
+
+// 记录订单，定期清理超过保留时间的订单
+func (p *orderRegistry) add(id string) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	p.expireIfDue(now)
+	p.orders[id] = now
+	p.persist(&ownedOrder{Id: id, Time: now})
+}
+
+// 记录没有收到响应的下单请求的订单签名
+func (p *orderRegistry) sign(signature string) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	p.expireIfDue(now)
+	p.signatures[signature] = now
+	p.persist(&ownedOrder{Signature: signature, Time: now})
+}
+
+// 过期记录定期清理，判断时同时检查保留时间
+func (p *orderRegistry) has(id string) bool {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.orders[id]
+	return ok && time.Since(t) <= ownedOrderTTL
+}
+
+func (p *orderRegistry) signed(signature string) bool {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.signatures[signature]
+	return ok && time.Since(t) <= ownedOrderTTL
+}
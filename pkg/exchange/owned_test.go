@@ -0,0 +1,182 @@
+package exchange
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 读取机器人订单记录文件，返回记录的订单id和签名
+func readOwnedFile(t *testing.T, file string) []string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("读取机器人订单记录失败. %s", err)
+	}
+
+	var keys []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var r = new(ownedOrder)
+		if err = json.Unmarshal([]byte(line), r); err != nil {
+			t.Fatalf("解析机器人订单记录失败. %s", err)
+		}
+		keys = append(keys, r.Id+r.Signature)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeOwnedFile(t *testing.T, file string, lines ...interface{}) {
+	var buf strings.Builder
+	for _, l := range lines {
+		if s, ok := l.(string); ok {
+			buf.WriteString(s + "\n")
+			continue
+		}
+		data, _ := json.Marshal(l)
+		buf.Write(append(data, '\n'))
+	}
+	if err := ioutil.WriteFile(file, []byte(buf.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeNumber(t *testing.T) {
+	for _, c := range []struct {
+		v      string
+		expect string
+	}{
+		{"1.5000", "1.5"},
+		{"100", "100"},
+		{"100.00", "100"},
+		{"0.00100", "0.001"},
+		{"1e-3", "0.001"},
+		{"abc", "abc"},
+	} {
+		if v := normalizeNumber(c.v); v != c.expect {
+			t.Errorf("%s 格式化为 %s, 应为 %s", c.v, v, c.expect)
+		}
+	}
+
+	// 订单签名与价格和数量的格式无关
+	if a, b := orderSignature("btc-usdt", "bid", "100.50", "2.0000"), orderSignature("btc-usdt", "BID", "100.5", "2"); a != b {
+		t.Errorf("订单签名 %s 和 %s 应相同", a, b)
+	}
+}
+
+func TestOrderRegistryRestart(t *testing.T) {
+	var file = filepath.Join(t.TempDir(), "owned", "orders.json")
+
+	p := newOrderRegistry(file)
+	p.add("1")
+	p.sign("btc-usdt/BID/100/1")
+
+	// 重启后仍然可以识别重启前创建的订单
+	restored := newOrderRegistry(file)
+	if !restored.has("1") || !restored.signed("btc-usdt/BID/100/1") {
+		t.Errorf("重启后没有恢复机器人订单记录")
+	}
+	if restored.has("2") || restored.signed("btc-usdt/ASK/100/1") {
+		t.Errorf("没有记录的订单不应认为是机器人的订单")
+	}
+
+	restored.add("2")
+	if keys := readOwnedFile(t, file); strings.Join(keys, ",") != "1,2,btc-usdt/BID/100/1" {
+		t.Errorf("文件中的记录 %v, 应为重启前后的全部记录", keys)
+	}
+}
+
+func TestOrderRegistryLoad(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "orders.json")
+		now  = time.Now()
+	)
+
+	// 加载时跳过过期记录，重复的记录只保留一条，整理后的文件只包含未过期的记录
+	writeOwnedFile(t, file,
+		&ownedOrder{Id: "fresh", Time: now.Add(-time.Hour)},
+		&ownedOrder{Id: "fresh", Time: now.Add(-time.Minute)},
+		&ownedOrder{Id: "old", Time: now.Add(-ownedOrderTTL - time.Minute)},
+		&ownedOrder{Signature: "btc-usdt/ASK/1/1", Time: now.Add(-time.Hour)},
+		&ownedOrder{Signature: "btc-usdt/BID/1/1", Time: now.Add(-ownedOrderTTL - time.Minute)},
+	)
+
+	p := newOrderRegistry(file)
+	if !p.has("fresh") || p.has("old") || !p.signed("btc-usdt/ASK/1/1") || p.signed("btc-usdt/BID/1/1") {
+		t.Errorf("加载结果 orders: %v, signatures: %v", p.orders, p.signatures)
+	}
+	if keys := readOwnedFile(t, file); strings.Join(keys, ",") != "btc-usdt/ASK/1/1,fresh" {
+		t.Errorf("整理后文件中的记录 %v, 应只有未过期的记录", keys)
+	}
+}
+
+func TestOrderRegistryLoadCorrupted(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "orders.json")
+		now  = time.Now()
+	)
+
+	// 最后一行写入不完整时保留之前的记录
+	writeOwnedFile(t, file, &ownedOrder{Id: "1", Time: now}, `{"id":"2","ti`)
+
+	p := newOrderRegistry(file)
+	if !p.has("1") || p.has("2") {
+		t.Errorf("加载结果 %v, 应只有完整的记录", p.orders)
+	}
+
+	p.add("3")
+	if keys := readOwnedFile(t, file); strings.Join(keys, ",") != "1,3" {
+		t.Errorf("文件中的记录 %v, 应去掉不完整的记录", keys)
+	}
+}
+
+func TestOrderRegistryExpire(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "orders.json")
+		p    = newOrderRegistry(file)
+		now  = time.Now()
+	)
+
+	p.add("1")
+	p.orders["old"] = now.Add(-ownedOrderTTL - time.Minute)
+	p.signatures["old"] = now.Add(-ownedOrderTTL - time.Minute)
+
+	// 过期记录在清理前也不认为是机器人的订单
+	if p.has("old") || p.signed("old") {
+		t.Errorf("超过保留时间的订单不应认为是机器人的订单")
+	}
+
+	// 距离上一次清理不到ownedExpireInterval时不清理
+	p.add("2")
+	if _, ok := p.orders["old"]; !ok {
+		t.Errorf("不到清理时间时不应清理过期记录")
+	}
+
+	p.expired = now.Add(-ownedExpireInterval - time.Minute)
+	p.sign("btc-usdt/BID/1/1")
+	if _, ok := p.orders["old"]; ok {
+		t.Errorf("过期记录没有清理")
+	}
+	if _, ok := p.signatures["old"]; ok {
+		t.Errorf("过期签名没有清理")
+	}
+	if keys := readOwnedFile(t, file); strings.Join(keys, ",") != "1,2,btc-usdt/BID/1/1" {
+		t.Errorf("清理后文件中的记录 %v, 应只有未过期的记录", keys)
+	}
+}
+
+func TestOrderRegistryMemoryOnly(t *testing.T) {
+	p := newOrderRegistry("")
+	p.add("1")
+	p.expired = time.Now().Add(-ownedExpireInterval - time.Minute)
+	p.add("2")
+	if !p.has("1") || !p.has("2") {
+		t.Errorf("没有设置文件时应在内存中记录订单")
+	}
+}
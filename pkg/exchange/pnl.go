@@ -0,0 +1,458 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/model"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内存中保留的每天盈亏记录数
+const maxPnlRecords = 366
+
+// 保存当天和累计盈亏的最小时间间隔
+const pnlSnapshotInterval = time.Minute
+
+// 每天的盈亏，以quote计价，
+// net = 挖矿收益 - 对敲手续费 - 平衡资产手续费 - 平衡资产滑点
+type PnlRecord struct {
+	Day               time.Time          `json:"day"`
+	WashVolume        float64            `json:"wash_volume"`        // 对敲成交的base数量，买卖双方分别计算
+	WashFee           float64            `json:"wash_fee"`           // 对敲支付的手续费
+	RebalanceVolume   float64            `json:"rebalance_volume"`   // 平衡资产成交的base数量
+	RebalanceFee      float64            `json:"rebalance_fee"`      // 平衡资产支付的手续费
+	RebalanceSlippage float64            `json:"rebalance_slippage"` // 平衡资产成交价相对下单时中间价的不利偏离
+	MinedOne          float64            `json:"mined_one"`          // 挖矿ONE数量估算
+	MiningRevenue     float64            `json:"mining_revenue"`     // 挖矿收益估算
+	Fees              map[string]float64 `json:"fees"`               // 按资产统计实际支付的手续费数量
+	Net               float64            `json:"net"`
+}
+
+func newPnlRecord(day time.Time) *PnlRecord {
+	return &PnlRecord{
+		Day:  day,
+		Fees: make(map[string]float64),
+	}
+}
+
+func (p *PnlRecord) copy() *PnlRecord {
+	var r = *p
+	r.Fees = make(map[string]float64, len(p.Fees))
+	for k, v := range p.Fees {
+		r.Fees[k] = v
+	}
+	return &r
+}
+
+// 盈亏统计状态，total为开始统计后的累计盈亏，重启后恢复
+type PnlStatus struct {
+	Today *PnlRecord `json:"today"`
+	Total *PnlRecord `json:"total"`
+}
+
+// 重启后恢复的盈亏状态
+type pnlSnapshot struct {
+	Today   *PnlRecord `json:"today"`
+	Total   *PnlRecord `json:"total"`
+	Hour    time.Time  `json:"hour"`
+	HourOne float64    `json:"hour_one"`
+}
+
+// 盈亏账本，每天结束时将当天的记录追加写入文件，
+// 当天和累计的盈亏定期保存到file.today，重启后恢复
+type pnlLedger struct {
+	sync.Mutex
+	file    string
+	today   *PnlRecord
+	total   *PnlRecord
+	records []*PnlRecord
+	saved   time.Time
+
+	// 当前小时的挖矿ONE估算，估算值是当前小时的累计值，每次只计入增加的部分
+	hour    time.Time
+	hourOne float64
+
+	// 最近一次收益估算的ONE价格，以quote计价，用于计算使用ONE支付的手续费数量
+	onePrice float64
+}
+
+func dayStart(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+func newPnlLedger(file string) *pnlLedger {
+	var now = time.Now()
+	var p = &pnlLedger{
+		file:  file,
+		today: newPnlRecord(dayStart(now)),
+		total: newPnlRecord(now),
+	}
+
+	if err := p.load(); err != nil {
+		log.Logger.Errorf("加载盈亏记录失败. %s", err)
+	}
+
+	if err := p.restore(now); err != nil {
+		log.Logger.Errorf("恢复当天盈亏失败. %s", err)
+	}
+
+	return p
+}
+
+func (p *pnlLedger) snapshotFile() string {
+	return p.file + ".today"
+}
+
+// 恢复重启前保存的当天和累计盈亏，保存的当天记录已经结束时作为已结束的记录写入文件
+func (p *pnlLedger) restore(now time.Time) error {
+	data, err := ioutil.ReadFile(p.snapshotFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshot = new(pnlSnapshot)
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return fmt.Errorf("解析记录失败. %s, data: %s", err, string(data))
+	}
+
+	for _, r := range []*PnlRecord{snapshot.Today, snapshot.Total} {
+		if r != nil && r.Fees == nil {
+			r.Fees = make(map[string]float64)
+		}
+	}
+
+	if snapshot.Total != nil {
+		p.total = snapshot.Total
+	}
+	p.hour, p.hourOne = snapshot.Hour, snapshot.HourOne
+
+	today := snapshot.Today
+	if today == nil {
+		return nil
+	}
+	if today.Day.Equal(p.today.Day) {
+		p.today = today
+		return nil
+	}
+
+	// 重启前没有结束的前一天记录
+	if n := len(p.records); today.Day.Before(p.today.Day) && (n == 0 || p.records[n-1].Day.Before(today.Day)) {
+		if err = p.persist(today); err != nil {
+			return err
+		}
+		p.records = append(p.records, today)
+		if len(p.records) > maxPnlRecords {
+			p.records = p.records[1:]
+		}
+	}
+
+	return nil
+}
+
+// 保存当天和累计盈亏，距离上一次保存不到pnlSnapshotInterval且没有进入新的一天时不保存
+func (p *pnlLedger) snapshot(now time.Time, force bool) {
+	if !force && now.Sub(p.saved) < pnlSnapshotInterval {
+		return
+	}
+	p.saved = now
+
+	data, err := json.Marshal(&pnlSnapshot{Today: p.today, Total: p.total, Hour: p.hour, HourOne: p.hourOne})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(p.file), 0755)
+	}
+	if err == nil {
+		tmp := p.snapshotFile() + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, p.snapshotFile())
+		}
+	}
+	if err != nil {
+		log.Logger.Errorf("保存当天盈亏失败. %s", err)
+	}
+}
+
+// 从文件加载每天的盈亏记录，每行一条json记录
+func (p *pnlLedger) load() error {
+	f, err := os.Open(p.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r = new(PnlRecord)
+		if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return fmt.Errorf("解析记录失败. %s, data: %s", err, scanner.Text())
+		}
+		p.records = append(p.records, r)
+	}
+
+	if len(p.records) > maxPnlRecords {
+		p.records = p.records[len(p.records)-maxPnlRecords:]
+	}
+
+	return scanner.Err()
+}
+
+// 追加一条已结束的每天记录到文件
+func (p *pnlLedger) persist(r *PnlRecord) error {
+	err := os.MkdirAll(filepath.Dir(p.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// 进入新的一天时结束当天的记录，返回结束的记录
+func (p *pnlLedger) rotate(now time.Time) *PnlRecord {
+	day := dayStart(now)
+	if day.Equal(p.today.Day) {
+		return nil
+	}
+
+	var done = p.today
+	if err := p.persist(done); err != nil {
+		log.Logger.Errorf("保存盈亏记录失败. %s", err)
+	}
+
+	p.records = append(p.records, done)
+	if len(p.records) > maxPnlRecords {
+		p.records = p.records[1:]
+	}
+
+	p.today = newPnlRecord(day)
+	return done
+}
+
+// 同时更新当天和累计的盈亏，返回因进入新的一天而结束的记录
+func (p *pnlLedger) apply(update func(r *PnlRecord)) (today, done *PnlRecord) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	done = p.rotate(now)
+	for _, r := range []*PnlRecord{p.today, p.total} {
+		update(r)
+		r.Net = r.MiningRevenue - r.WashFee - r.RebalanceFee - r.RebalanceSlippage
+	}
+	p.snapshot(now, done != nil)
+
+	return p.today.copy(), done
+}
+
+// 更新当前小时的挖矿ONE估算，返回新增的ONE数量
+func (p *pnlLedger) mined(hour time.Time, one, onePrice float64) float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	if onePrice > 0 {
+		p.onePrice = onePrice
+	}
+
+	var delta = one
+	if hour.Equal(p.hour) {
+		delta = one - p.hourOne
+	}
+	p.hour = hour
+	p.hourOne = one
+	return delta
+}
+
+func (p *pnlLedger) oneQuotePrice() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.onePrice
+}
+
+func (p *pnlLedger) Status() *PnlStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	var s = &PnlStatus{
+		Today: p.today.copy(),
+		Total: p.total.copy(),
+	}
+
+	// 没有成交时不会结束前一天的记录，状态中按新的一天显示
+	if day := dayStart(time.Now()); !day.Equal(s.Today.Day) {
+		s.Today = newPnlRecord(day)
+	}
+
+	return s
+}
+
+// 获取已结束的每天记录和当天记录的拷贝
+func (p *pnlLedger) Records() []*PnlRecord {
+	p.Lock()
+	defer p.Unlock()
+
+	var records = make([]*PnlRecord, 0, len(p.records)+1)
+	for _, r := range p.records {
+		records = append(records, r.copy())
+	}
+	return append(records, p.today.copy())
+}
+
+// 一笔成交的手续费，返回折合quote的手续费以及实际支付的资产和数量，
+// 使用ONE支付且不知道ONE价格时不统计实际支付的数量
+func (p *Exchange) fillFee(fee *model.FeeModelConfig, side string, amount, price float64, maker bool) (value float64, asset string, paid float64) {
+	var rate = fee.Rate(maker)
+	value = amount * price * rate
+
+	switch {
+	case fee.FeeAsset == model.FeeAssetOne:
+		if onePrice := p.pnl.oneQuotePrice(); onePrice > 0 {
+			return value, "ONE", value / onePrice
+		}
+		return value, "", 0
+	case fee.FeeAsset == model.FeeAssetReceived && side == BidOrderTypeName:
+		return value, p.symbolPair.BaseAsset.Symbol, amount * rate
+	default:
+		return value, p.symbolPair.QuoteAsset.Symbol, value
+	}
+}
+
+// 记录对敲一方的成交，下单时已经成交的订单为吃单，
+// 否则认为与对敲的另一个订单以相同数量挂单成交
+func (p *Exchange) recordWashPnl(cfg *model.Configuration, price, filled float64, order *model.Order) {
+	if order == nil {
+		return
+	}
+
+	var (
+		side       = BidOrderTypeName
+		initial, _ = strconv.ParseFloat(order.FilledAmount, 10)
+	)
+	if strings.ToUpper(order.Side) == AskOrderTypeName {
+		side = AskOrderTypeName
+	}
+
+	p.recordWashFill(cfg, side, price, filled, initial <= 0)
+}
+
+// 记录对敲一方的成交数量，下单返回后才成交的数量为挂单成交，maker为true
+func (p *Exchange) recordWashFill(cfg *model.Configuration, side string, price, filled float64, maker bool) {
+	if p.pnl == nil || filled <= 0 {
+		return
+	}
+
+	value, asset, paid := p.fillFee(cfg.FeeModel, side, filled, price, maker)
+	p.updatePnl(cfg, func(r *PnlRecord) {
+		r.WashVolume += filled
+		r.WashFee += value
+		if asset != "" {
+			r.Fees[asset] += paid
+		}
+	})
+}
+
+// 记录平衡资产的成交，滑点为成交价相对参考价格的不利偏离，参考价格为下单时的中间价
+func (p *Exchange) recordRebalancePnl(cfg *model.Configuration, side string, amount, price, reference float64, maker bool) {
+	if p.pnl == nil || amount <= 0 {
+		return
+	}
+
+	var slippage float64
+	if reference > 0 {
+		slippage = (price - reference) * amount
+		if side == AskOrderTypeName {
+			slippage = -slippage
+		}
+	}
+
+	value, asset, paid := p.fillFee(cfg.FeeModel, side, amount, price, maker)
+	p.updatePnl(cfg, func(r *PnlRecord) {
+		r.RebalanceVolume += amount
+		r.RebalanceFee += value
+		r.RebalanceSlippage += slippage
+		if asset != "" {
+			r.Fees[asset] += paid
+		}
+	})
+}
+
+// 根据收益估算更新挖矿收益
+func (p *Exchange) updatePnlMining(yield *yieldEstimate) {
+	if p.pnl == nil || yield == nil {
+		return
+	}
+
+	hour, err := time.Parse(statTimeLayout, yield.StatTime)
+	if err != nil {
+		hour = yield.EstimatedTime
+	}
+
+	one := p.pnl.mined(hour.Truncate(time.Hour), yield.OwnMinedOne, yield.OnePriceQuote)
+	p.updatePnl(p.conf(), func(r *PnlRecord) {
+		r.MinedOne += one
+		r.MiningRevenue += one * yield.OnePriceQuote
+	})
+}
+
+// 更新盈亏，进入新的一天时输出前一天的盈亏报告
+func (p *Exchange) updatePnl(cfg *model.Configuration, update func(r *PnlRecord)) {
+	today, done := p.pnl.apply(update)
+	if done != nil {
+		p.reportPnl(done)
+	}
+
+	for component, v := range map[string]float64{
+		"wash_fee":           today.WashFee,
+		"rebalance_fee":      today.RebalanceFee,
+		"rebalance_slippage": today.RebalanceSlippage,
+		"mining_revenue":     today.MiningRevenue,
+		"net":                today.Net,
+	} {
+		metrics.PnlToday.WithLabelValues(cfg.Account, p.symbolPair.Name, component).Set(v)
+	}
+}
+
+// 输出每天的盈亏报告
+func (p *Exchange) reportPnl(r *PnlRecord) {
+	quote := p.symbolPair.QuoteAsset.Symbol
+	p.logger.Infof("%s 盈亏报告: 挖矿收益 %f %s (%f ONE), 对敲手续费 %f %s, 平衡资产手续费 %f %s, 平衡资产滑点 %f %s, 净盈亏 %f %s, 实际支付手续费 %v",
+		r.Day.Format("2006-01-02"), r.MiningRevenue, quote, r.MinedOne, r.WashFee, quote,
+		r.RebalanceFee, quote, r.RebalanceSlippage, quote, r.Net, quote, r.Fees)
+}
+
+// 以json格式输出每天的盈亏
+func (p *Exchange) ServePnl(resp http.ResponseWriter, req *http.Request) {
+	if p.pnl == nil {
+		http.Error(resp, "pnl disabled", http.StatusNotFound)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(p.pnl.Records())
+}
@@ -0,0 +1,254 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 读取盈亏记录文件中的每天记录
+func readPnlRecords(t *testing.T, file string) []*PnlRecord {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("读取盈亏记录失败. %s", err)
+	}
+
+	var records []*PnlRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r = new(PnlRecord)
+		if err = json.Unmarshal([]byte(line), r); err != nil {
+			t.Fatalf("解析盈亏记录失败. %s", err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func writePnlSnapshot(t *testing.T, file string, snapshot *pnlSnapshot) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(file+".today", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPnlLedgerRotate(t *testing.T) {
+	var (
+		file  = filepath.Join(t.TempDir(), "pnl.json")
+		p     = newPnlLedger(file)
+		now   = time.Now()
+		today = dayStart(now)
+	)
+
+	if done := p.rotate(now); done != nil {
+		t.Fatalf("同一天不应结束记录, 结束了 %v", done.Day)
+	}
+
+	// 模拟运行到第二天
+	p.today = newPnlRecord(today.AddDate(0, 0, -1))
+	p.today.WashFee = 1.5
+	done := p.rotate(now)
+	if done == nil || !done.Day.Equal(today.AddDate(0, 0, -1)) || done.WashFee != 1.5 {
+		t.Fatalf("进入新的一天应结束前一天的记录, 结束记录 %+v", done)
+	}
+	if !p.today.Day.Equal(today) || p.today.WashFee != 0 {
+		t.Errorf("新的一天记录 %+v 应从0开始", p.today)
+	}
+
+	records := readPnlRecords(t, file)
+	if len(records) != 1 || records[0].WashFee != 1.5 {
+		t.Errorf("文件中的记录 %+v 应只有结束的一天", records)
+	}
+
+	// 重启后加载已结束的记录
+	if loaded := newPnlLedger(file).Records(); len(loaded) != 2 || loaded[0].WashFee != 1.5 || !loaded[1].Day.Equal(today) {
+		t.Errorf("重启后记录 %+v 应为结束的一天和当天", loaded)
+	}
+}
+
+func TestPnlLedgerApply(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "pnl.json")
+		p    = newPnlLedger(file)
+	)
+
+	today, done := p.apply(func(r *PnlRecord) {
+		r.MiningRevenue += 10
+		r.WashFee += 3
+		r.RebalanceFee += 1
+		r.RebalanceSlippage += 0.5
+	})
+	if done != nil {
+		t.Errorf("同一天不应结束记录")
+	}
+	if today.Net != 5.5 {
+		t.Errorf("当天净盈亏 %f, 应为 5.5", today.Net)
+	}
+
+	// 返回的是拷贝，之后的更新不影响
+	today.Fees["BTC"] = 1
+	p.apply(func(r *PnlRecord) { r.WashFee += 1 })
+	if s := p.Status(); s.Today.Net != 4.5 || s.Total.Net != 4.5 || len(s.Today.Fees) != 0 {
+		t.Errorf("当天 %+v 累计 %+v, 净盈亏应为 4.5", s.Today, s.Total)
+	}
+}
+
+func TestPnlLedgerRestore(t *testing.T) {
+	var (
+		now       = time.Now()
+		today     = dayStart(now)
+		yesterday = today.AddDate(0, 0, -1)
+		hour      = now.Truncate(time.Hour)
+	)
+
+	t.Run("same day", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "pnl.json")
+		p := newPnlLedger(file)
+		p.mined(hour, 5, 0.1)
+		p.apply(func(r *PnlRecord) {
+			r.WashFee += 2
+			r.Fees["BTC"] += 0.01
+		})
+
+		// 重启后恢复当天、累计和当前小时的挖矿估算
+		restored := newPnlLedger(file)
+		s := restored.Status()
+		if s.Today.WashFee != 2 || s.Today.Fees["BTC"] != 0.01 || s.Total.WashFee != 2 {
+			t.Errorf("恢复的当天 %+v 累计 %+v, 对敲手续费应为 2", s.Today, s.Total)
+		}
+		if one := restored.mined(hour, 8, 0); one != 3 {
+			t.Errorf("恢复后当前小时新增ONE %f, 应为 3", one)
+		}
+	})
+
+	t.Run("previous day", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "pnl.json")
+		prev := newPnlRecord(yesterday)
+		prev.WashFee = 4
+		total := newPnlRecord(yesterday)
+		total.WashFee = 9
+		writePnlSnapshot(t, file, &pnlSnapshot{Today: prev, Total: total})
+
+		// 重启前没有结束的前一天作为已结束的记录写入文件，当天从0开始
+		p := newPnlLedger(file)
+		s := p.Status()
+		if s.Today.WashFee != 0 || s.Total.WashFee != 9 {
+			t.Errorf("当天 %+v 应从0开始, 累计 %+v 应恢复", s.Today, s.Total)
+		}
+		records := readPnlRecords(t, file)
+		if len(records) != 1 || records[0].WashFee != 4 || !records[0].Day.Equal(yesterday) {
+			t.Errorf("文件中的记录 %+v 应为前一天", records)
+		}
+
+		// 再次重启时前一天已经写入文件，不重复写入
+		newPnlLedger(file)
+		if records = readPnlRecords(t, file); len(records) != 1 {
+			t.Errorf("再次重启后文件中有 %d 条记录, 应为1条", len(records))
+		}
+	})
+
+	t.Run("no snapshot", func(t *testing.T) {
+		p := newPnlLedger(filepath.Join(t.TempDir(), "pnl.json"))
+		if s := p.Status(); !s.Today.Day.Equal(today) || s.Today.Fees == nil || s.Total.Net != 0 {
+			t.Errorf("没有保存的盈亏时当天 %+v 应从0开始", s.Today)
+		}
+	})
+}
+
+func TestPnlLedgerMined(t *testing.T) {
+	var (
+		p    = newPnlLedger(filepath.Join(t.TempDir(), "pnl.json"))
+		hour = time.Date(2021, 3, 3, 10, 0, 0, 0, time.Local)
+	)
+
+	// 估算值是当前小时的累计值，只计入增加的部分
+	for i, c := range []struct {
+		hour     time.Time
+		one      float64
+		onePrice float64
+		delta    float64
+		price    float64
+	}{
+		{hour: hour, one: 5, onePrice: 0.1, delta: 5, price: 0.1},
+		{hour: hour, one: 8, delta: 3, price: 0.1},
+		{hour: hour, one: 8, onePrice: 0.2, delta: 0, price: 0.2},
+		{hour: hour.Add(time.Hour), one: 2, delta: 2, price: 0.2},
+	} {
+		if delta := p.mined(c.hour, c.one, c.onePrice); delta != c.delta {
+			t.Errorf("第%d次估算新增 %f, 应为 %f", i+1, delta, c.delta)
+		}
+		if price := p.oneQuotePrice(); price != c.price {
+			t.Errorf("第%d次估算后ONE价格 %f, 应为 %f", i+1, price, c.price)
+		}
+	}
+}
+
+func TestFillFee(t *testing.T) {
+	var fee = &model.FeeModelConfig{MakerRate: 0.001, TakerRate: 0.002}
+
+	for _, c := range []struct {
+		name     string
+		asset    string
+		onePrice float64
+		side     string
+		maker    bool
+		value    float64
+		paid     string
+		amount   float64
+	}{
+		{name: "received bid", asset: model.FeeAssetReceived, side: BidOrderTypeName, value: 0.4, paid: "BTC", amount: 0.004},
+		{name: "received ask", asset: model.FeeAssetReceived, side: AskOrderTypeName, maker: true, value: 0.2, paid: "USDT", amount: 0.2},
+		{name: "quote bid", asset: model.FeeAssetQuote, side: BidOrderTypeName, value: 0.4, paid: "USDT", amount: 0.4},
+		// 使用ONE支付时扣除折扣，按ONE价格折算数量
+		{name: "one", asset: model.FeeAssetOne, onePrice: 0.02, side: AskOrderTypeName, value: 0.2, paid: "ONE", amount: 10},
+		{name: "one without price", asset: model.FeeAssetOne, side: BidOrderTypeName, maker: true, value: 0.1},
+	} {
+		var (
+			cfg = *fee
+			p   = newTestExchange(&model.Configuration{}, nil)
+		)
+		cfg.FeeAsset = c.asset
+		cfg.OneDiscount = 50
+		p.pnl = newPnlLedger(filepath.Join(t.TempDir(), "pnl.json"))
+		if c.onePrice > 0 {
+			p.pnl.mined(time.Now(), 0, c.onePrice)
+		}
+
+		value, asset, paid := p.fillFee(&cfg, c.side, 2, 100, c.maker)
+		if !floatEqual(value, c.value) || asset != c.paid || !floatEqual(paid, c.amount) {
+			t.Errorf("%s: 手续费 %f %s %f, 应为 %f %s %f", c.name, value, asset, paid, c.value, c.paid, c.amount)
+		}
+	}
+}
+
+func TestRecordWashPnl(t *testing.T) {
+	var (
+		cfg = &model.Configuration{
+			FeeModel: &model.FeeModelConfig{MakerRate: 0.001, TakerRate: 0.002, FeeAsset: model.FeeAssetQuote},
+		}
+		p = newTestExchange(cfg, nil)
+	)
+	p.pnl = newPnlLedger(filepath.Join(t.TempDir(), "pnl.json"))
+
+	// 下单时已成交的订单按吃单，另一方按挂单，之后成交的数量按挂单
+	p.recordWashPnl(cfg, 100, 2, &model.Order{Side: "bid", FilledAmount: "2"})
+	p.recordWashPnl(cfg, 100, 2, &model.Order{Side: "ASK", FilledAmount: "0"})
+	p.recordWashFill(cfg, BidOrderTypeName, 100, 1, true)
+	p.recordWashFill(cfg, AskOrderTypeName, 100, 1, true)
+	p.recordWashPnl(cfg, 100, 0, &model.Order{Side: "BID"})
+	p.recordWashPnl(cfg, 100, 1, nil)
+
+	s := p.pnl.Status()
+	if s.Today.WashVolume != 6 || !floatEqual(s.Today.WashFee, 0.8) || !floatEqual(s.Today.Fees["USDT"], 0.8) {
+		t.Errorf("当天对敲成交 %f 手续费 %f, 应为 6 0.8", s.Today.WashVolume, s.Today.WashFee)
+	}
+	if !floatEqual(s.Today.Net, -0.8) {
+		t.Errorf("当天净盈亏 %f, 应为 -0.8", s.Today.Net)
+	}
+}
@@ -0,0 +1,102 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"time"
+)
+
+// 计算挖矿速度时新样本的权重
+const minedRateWeight = 0.5
+
+// 当前小时挖矿量样本
+type minedSample struct {
+	hour  time.Time
+	at    time.Time
+	mined float64
+}
+
+// 根据相邻两次统计的挖矿量估算当前小时的挖矿速度，单位为ONE/秒，
+// 新的小时开始或统计数据减少时重新计算
+func (p *limitationChecker) updateMinedRate(stat *model.OneHourlyLimitationResponeBody) float64 {
+	if stat == nil || stat.Data == nil {
+		return 0
+	}
+
+	var sample = minedSample{
+		at:    time.Now(),
+		mined: stat.Data.TradeMineOne + stat.Data.InviteMineOne,
+	}
+	if t, err := time.Parse(statTimeLayout, stat.Data.StatTime); err == nil {
+		sample.hour = t.Truncate(time.Hour)
+		sample.at = t
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	last := p.lastSample
+	p.lastSample = &sample
+
+	if last == nil || !last.hour.Equal(sample.hour) || sample.mined < last.mined {
+		p.minedRate = 0
+		return 0
+	}
+
+	elapsed := sample.at.Sub(last.at).Seconds()
+	if elapsed <= 0 {
+		return p.minedRate
+	}
+
+	rate := (sample.mined - last.mined) / elapsed
+	if p.minedRate == 0 {
+		p.minedRate = rate
+	} else {
+		p.minedRate = minedRateWeight*rate + (1-minedRateWeight)*p.minedRate
+	}
+
+	return p.minedRate
+}
+
+// 按当前挖矿速度预测下一次检查时已挖矿量占限额的比例，超过限额百分比时提前停止挖矿，
+// 停止后直到进入新的小时都保持停止
+func (p *limitationChecker) predictStop(stat *model.OneHourlyLimitationResponeBody, cfg *model.Configuration) bool {
+	rate := p.updateMinedRate(stat)
+	if !cfg.PredictiveStopEnable {
+		return false
+	}
+
+	p.RLock()
+	stopped := p.predictStopped
+	p.RUnlock()
+	if stopped {
+		log.Logger.Debugf("当前小时已预测停止挖矿，等待进入新的小时")
+		return true
+	}
+
+	if rate <= 0 || p.limitation <= 0 {
+		return false
+	}
+
+	var (
+		mined     = stat.Data.TradeMineOne + stat.Data.InviteMineOne
+		interval  = time.Duration(cfg.CheckLimitationInterval) * time.Millisecond
+		projected = (mined + rate*interval.Seconds()*cfg.PredictiveStopFactor) * 100.0 / p.limitation
+	)
+
+	p.Lock()
+	p.projectedPercent = projected
+	p.Unlock()
+
+	log.Logger.Debugf("当前挖矿速度 %f ONE/秒，预计下一次检查时已挖矿量占限额比例: %2.2f%%", rate, projected)
+	if projected < float64(cfg.OneHourlyLimitationPercent) {
+		return false
+	}
+
+	log.Logger.Infof("预计下一次检查时已挖矿量将达到限额的%2.2f%%，超过%d%%，提前停止挖矿",
+		projected, cfg.OneHourlyLimitationPercent)
+	p.Lock()
+	p.predictStopped = true
+	p.Unlock()
+	return true
+}
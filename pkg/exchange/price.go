@@ -0,0 +1,193 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 行情价格记录
+type priceSample struct {
+	time  time.Time
+	price float64
+}
+
+// 行情异常检查，行情异常时暂停交易，连续recover_count次行情正常后恢复
+type priceGuard struct {
+	sync.Mutex
+	samples     []priceSample
+	lastQuote   string
+	lastChange  time.Time
+	abnormal    bool
+	reason      string
+	since       time.Time
+	normalCount int
+}
+
+// 行情异常检查状态
+type PriceGuardStatus struct {
+	Reference float64   `json:"reference"`
+	Abnormal  bool      `json:"abnormal"`
+	Reason    string    `json:"reason,omitempty"`
+	Since     time.Time `json:"since,omitempty"`
+}
+
+func parsePriceAmount(v *model.PriceAmount) (price, amount float64) {
+	if v == nil {
+		return 0, 0
+	}
+	price, _ = strconv.ParseFloat(v.Price, 10)
+	amount, _ = strconv.ParseFloat(v.Amount, 10)
+	return price, amount
+}
+
+// 参考价格，为时间窗口内中间价的中位数，没有记录时返回0
+func (p *priceGuard) reference(window time.Duration, now time.Time) float64 {
+	var i int
+	for i < len(p.samples) && now.Sub(p.samples[i].time) > window {
+		i++
+	}
+	p.samples = p.samples[i:]
+
+	if len(p.samples) == 0 {
+		return 0
+	}
+
+	var prices = make([]float64, 0, len(p.samples))
+	for _, s := range p.samples {
+		prices = append(prices, s.price)
+	}
+	sort.Float64s(prices)
+
+	n := len(prices)
+	if n%2 == 1 {
+		return prices[n/2]
+	}
+	return (prices[n/2-1] + prices[n/2]) / 2
+}
+
+// 检查行情，返回异常原因，行情正常时返回空字符串
+func (p *priceGuard) inspect(cfg *model.PriceGuardConfig, ticker *model.Ticker, now time.Time) string {
+	if ticker == nil || ticker.Ask == nil || ticker.Bid == nil {
+		return "行情数据为空"
+	}
+
+	askPrice, askAmount := parsePriceAmount(ticker.Ask)
+	bidPrice, bidAmount := parsePriceAmount(ticker.Bid)
+	if askPrice <= 0 || bidPrice <= 0 {
+		return fmt.Sprintf("价格无效, ask: %q, bid: %q", ticker.Ask.Price, ticker.Bid.Price)
+	}
+
+	if askPrice <= bidPrice {
+		return fmt.Sprintf("卖一价 %f 不高于买一价 %f", askPrice, bidPrice)
+	}
+
+	// 买一卖一价格和数量都没有变化时认为行情没有更新
+	quote := fmt.Sprintf("%s/%s/%s/%s", ticker.Bid.Price, ticker.Bid.Amount, ticker.Ask.Price, ticker.Ask.Amount)
+	if quote != p.lastQuote {
+		p.lastQuote = quote
+		p.lastChange = now
+	}
+
+	var (
+		mid       = (askPrice + bidPrice) / 2
+		window    = time.Duration(cfg.ReferenceWindow) * time.Millisecond
+		reference = p.reference(window, now)
+	)
+
+	if cfg.ReferenceWindow > 0 {
+		p.samples = append(p.samples, priceSample{time: now, price: mid})
+	}
+
+	if cfg.MinBookAmount > 0 && (askAmount < cfg.MinBookAmount || bidAmount < cfg.MinBookAmount) {
+		return fmt.Sprintf("买一数量 %f 或卖一数量 %f 小于 %f", bidAmount, askAmount, cfg.MinBookAmount)
+	}
+
+	if cfg.StaleTickerTime > 0 && now.Sub(p.lastChange) > time.Duration(cfg.StaleTickerTime)*time.Millisecond {
+		return fmt.Sprintf("行情 %d 毫秒没有变化", now.Sub(p.lastChange)/time.Millisecond)
+	}
+
+	if cfg.MaxDeviationPercent > 0 && reference > 0 {
+		deviation := math.Abs(mid-reference) * 100 / reference
+		if deviation > cfg.MaxDeviationPercent {
+			return fmt.Sprintf("中间价 %f 偏离参考价格 %f 达到 %.2f%%, 超过 %.2f%%",
+				mid, reference, deviation, cfg.MaxDeviationPercent)
+		}
+	}
+
+	return ""
+}
+
+// 检查行情并更新状态，返回是否允许交易、原因以及状态是否改变
+func (p *priceGuard) observe(cfg *model.PriceGuardConfig, ticker *model.Ticker, now time.Time) (ok bool, reason string, changed bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	reason = p.inspect(cfg, ticker, now)
+	if reason != "" {
+		changed = !p.abnormal
+		if changed {
+			p.since = now
+		}
+		p.abnormal = true
+		p.reason = reason
+		p.normalCount = 0
+		return false, reason, changed
+	}
+
+	if !p.abnormal {
+		return true, "", false
+	}
+
+	p.normalCount++
+	if p.normalCount < cfg.RecoverCount {
+		return false, fmt.Sprintf("等待行情恢复正常(%d/%d), %s", p.normalCount, cfg.RecoverCount, p.reason), false
+	}
+
+	p.abnormal = false
+	p.reason = ""
+	p.since = time.Time{}
+	p.normalCount = 0
+	return true, "", true
+}
+
+func (p *priceGuard) Status(cfg *model.PriceGuardConfig) *PriceGuardStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	var s = &PriceGuardStatus{
+		Abnormal: p.abnormal,
+		Reason:   p.reason,
+		Since:    p.since,
+	}
+
+	if cfg.ReferenceWindow > 0 {
+		s.Reference = p.reference(time.Duration(cfg.ReferenceWindow)*time.Millisecond, time.Now())
+	}
+
+	return s
+}
+
+// 检查行情是否正常，异常时暂停交易直到行情恢复正常
+func (p *Exchange) checkTicker(cfg *model.Configuration, ticker *model.MarketTickerResponeBody) bool {
+	var data *model.Ticker
+	if ticker != nil {
+		data = ticker.Data
+	}
+
+	ok, reason, changed := p.price.observe(cfg.PriceGuard, data, time.Now())
+	switch {
+	case changed && ok:
+		p.logger.Infof("行情恢复正常，恢复交易")
+	case changed:
+		p.logger.Errorf("行情异常，暂停交易. %s", reason)
+	case !ok:
+		p.logger.Infof("行情异常，暂停交易. %s", reason)
+	}
+
+	return ok
+}
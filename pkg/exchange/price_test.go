@@ -0,0 +1,165 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTicker(bid, bidAmount, ask, askAmount string) *model.Ticker {
+	return &model.Ticker{
+		Bid: &model.PriceAmount{Price: bid, Amount: bidAmount},
+		Ask: &model.PriceAmount{Price: ask, Amount: askAmount},
+	}
+}
+
+func TestPriceGuardReference(t *testing.T) {
+	var (
+		p      = new(priceGuard)
+		now    = time.Now()
+		window = 10 * time.Second
+	)
+
+	if ref := p.reference(window, now); ref != 0 {
+		t.Errorf("没有记录时参考价格 %f, 应为0", ref)
+	}
+
+	for i, price := range []float64{300, 100, 120, 110} {
+		p.samples = append(p.samples, priceSample{time: now.Add(time.Duration(i-3) * 4 * time.Second), price: price})
+	}
+
+	// 中位数不受单个异常价格影响，超出时间窗口的记录被移除
+	for _, c := range []struct {
+		now       time.Time
+		reference float64
+		samples   int
+	}{
+		{now: now, reference: 110, samples: 3},
+		{now: now.Add(3 * time.Second), reference: 115, samples: 2},
+		{now: now.Add(8 * time.Second), reference: 110, samples: 1},
+		{now: now.Add(11 * time.Second), reference: 0, samples: 0},
+	} {
+		if ref := p.reference(window, c.now); ref != c.reference || len(p.samples) != c.samples {
+			t.Errorf("%v: 参考价格 %f 记录数 %d, 应为 %f %d", c.now.Sub(now), ref, len(p.samples), c.reference, c.samples)
+		}
+	}
+}
+
+func TestPriceGuardObserve(t *testing.T) {
+	type step struct {
+		after   time.Duration
+		ticker  *model.Ticker
+		ok      bool
+		changed bool
+		reason  string
+	}
+
+	var (
+		normal = testTicker("99", "5", "101", "5")
+		moved  = testTicker("100", "5", "102", "5")
+	)
+
+	for _, c := range []struct {
+		name   string
+		config *model.PriceGuardConfig
+		steps  []step
+	}{
+		{
+			name:   "invalid ticker",
+			config: &model.PriceGuardConfig{RecoverCount: 1},
+			steps: []step{
+				{ticker: nil, changed: true, reason: "行情数据为空"},
+				{ticker: testTicker("0", "1", "101", "1"), reason: "价格无效"},
+				{ticker: testTicker("101", "1", "101", "1"), reason: "不高于买一价"},
+				{ticker: normal, ok: true, changed: true},
+				{ticker: normal, ok: true},
+			},
+		},
+		{
+			// 参考价格为窗口内中间价的中位数，异常的中间价也计入窗口
+			name:   "median reference",
+			config: &model.PriceGuardConfig{ReferenceWindow: 10000, MaxDeviationPercent: 5, RecoverCount: 1},
+			steps: []step{
+				{ticker: normal, ok: true},
+				{after: time.Second, ticker: moved, ok: true},
+				{after: 2 * time.Second, ticker: testTicker("199", "5", "201", "5"), changed: true, reason: "偏离参考价格"},
+				{after: 3 * time.Second, ticker: testTicker("102", "5", "104", "5"), ok: true, changed: true},
+				// 窗口内只剩最近两个中间价 200 和 103
+				{after: 11500 * time.Millisecond, ticker: testTicker("149", "5", "151", "5"), ok: true},
+			},
+		},
+		{
+			name:   "stale ticker",
+			config: &model.PriceGuardConfig{StaleTickerTime: 1000, RecoverCount: 1},
+			steps: []step{
+				{ticker: normal, ok: true},
+				{after: 900 * time.Millisecond, ticker: normal, ok: true},
+				{after: 1100 * time.Millisecond, ticker: normal, changed: true, reason: "行情 1100 毫秒没有变化"},
+				// 数量变化也是行情更新
+				{after: 1200 * time.Millisecond, ticker: testTicker("99", "6", "101", "5"), ok: true, changed: true},
+				{after: 2100 * time.Millisecond, ticker: testTicker("99", "6", "101", "5"), ok: true},
+			},
+		},
+		{
+			name:   "min book amount",
+			config: &model.PriceGuardConfig{MinBookAmount: 1, RecoverCount: 1},
+			steps: []step{
+				{ticker: testTicker("99", "0.5", "101", "5"), changed: true, reason: "买一数量 0.500000 或卖一数量 5.000000 小于 1.000000"},
+				{ticker: testTicker("99", "5", "101", "0.9"), reason: "小于 1.000000"},
+				{ticker: testTicker("99", "1", "101", "1"), ok: true, changed: true},
+			},
+		},
+		{
+			// 连续recover_count次正常后恢复，中间出现异常时重新计数
+			name:   "recover count",
+			config: &model.PriceGuardConfig{MinBookAmount: 1, RecoverCount: 3},
+			steps: []step{
+				{ticker: testTicker("99", "0.5", "101", "5"), changed: true, reason: "小于"},
+				{ticker: normal, reason: "等待行情恢复正常(1/3)"},
+				{ticker: testTicker("99", "0.5", "101", "5"), reason: "小于"},
+				{ticker: normal, reason: "等待行情恢复正常(1/3)"},
+				{ticker: normal, reason: "等待行情恢复正常(2/3)"},
+				{ticker: normal, ok: true, changed: true},
+				{ticker: normal, ok: true},
+			},
+		},
+	} {
+		var (
+			p     = new(priceGuard)
+			start = time.Now()
+		)
+		for i, s := range c.steps {
+			ok, reason, changed := p.observe(c.config, s.ticker, start.Add(s.after))
+			if ok != s.ok || changed != s.changed || !strings.Contains(reason, s.reason) || (s.reason == "") != (reason == "") {
+				t.Errorf("%s: 第%d次检查结果 %v %v %q, 应为 %v %v %q", c.name, i+1, ok, changed, reason, s.ok, s.changed, s.reason)
+			}
+		}
+	}
+}
+
+func TestCheckTicker(t *testing.T) {
+	var (
+		cfg = &model.Configuration{PriceGuard: &model.PriceGuardConfig{MinBookAmount: 1, RecoverCount: 2}}
+		p   = newTestExchange(cfg, nil)
+	)
+
+	for i, c := range []struct {
+		ticker   *model.MarketTickerResponeBody
+		ok       bool
+		abnormal bool
+	}{
+		{ticker: &model.MarketTickerResponeBody{Data: testTicker("99", "2", "101", "2")}, ok: true},
+		{ticker: nil, abnormal: true},
+		{ticker: &model.MarketTickerResponeBody{Data: testTicker("99", "0.1", "101", "2")}, abnormal: true},
+		{ticker: &model.MarketTickerResponeBody{Data: testTicker("99", "2", "101", "2")}, abnormal: true},
+		{ticker: &model.MarketTickerResponeBody{Data: testTicker("99", "2", "101", "3")}, ok: true},
+	} {
+		if ok := p.checkTicker(cfg, c.ticker); ok != c.ok {
+			t.Errorf("第%d次检查结果 %v, 应为 %v", i+1, ok, c.ok)
+		}
+		if s := p.price.Status(cfg.PriceGuard); s.Abnormal != c.abnormal {
+			t.Errorf("第%d次检查后状态 %+v, 异常应为 %v", i+1, s, c.abnormal)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"math"
+	"strconv"
+)
+
+// 当前base资产价值占总资产价值的百分比，以及平衡到目标比例需要买入的base数量，卖出时为负，
+// 还没有行情或资产时ok为false
+func (p *Exchange) targetDelta(cfg *model.Configuration) (ratio, delta float64, ok bool) {
+	p.RLock()
+	defer p.RUnlock()
+
+	mid := (p.askPrice + p.bidPrice) / 2
+	total := p.baseBalance*mid + p.quoteBalance
+	if mid <= 0 || total <= 0 {
+		return 0, 0, false
+	}
+
+	ratio = p.baseBalance * mid * 100 / total
+	delta = (total*cfg.RebalanceTarget.BaseRatio/100 - p.baseBalance*mid) / mid
+	return ratio, delta, true
+}
+
+// 资产比例是否超出容忍范围
+func (p *Exchange) outOfBand(cfg *model.Configuration) bool {
+	ratio, _, ok := p.targetDelta(cfg)
+	return ok && math.Abs(ratio-cfg.RebalanceTarget.BaseRatio) > cfg.RebalanceTarget.Tolerance
+}
+
+// 在买一卖一价之间的挂单价格，价差只有一个最小价格单位时使用买一或卖一价
+func (p *Exchange) insidePrice(side string, bid, ask, position float64) float64 {
+	var (
+		tick   = math.Pow10(-p.symbolPair.BaseScale)
+		offset = math.Max((ask-bid)*position/100, tick)
+	)
+
+	if side == BidOrderTypeName {
+		if price := bid + offset; price < ask-tick/2 {
+			return price
+		}
+		return bid
+	}
+
+	if price := ask - offset; price > bid+tick/2 {
+		return price
+	}
+	return ask
+}
+
+// 按目标资产比例平衡资产，资产比例超出容忍范围时挂限价单，返回是否处理了平衡
+func (p *Exchange) rebalanceToTarget(cfg *model.Configuration) bool {
+	var (
+		target           = cfg.RebalanceTarget
+		ratio, delta, ok = p.targetDelta(cfg)
+		side             = BidOrderTypeName
+		amount           = math.Abs(delta)
+	)
+
+	if !ok || math.Abs(ratio-target.BaseRatio) <= target.Tolerance {
+		return false
+	}
+
+	if delta < 0 {
+		side = AskOrderTypeName
+	}
+
+	if target.MaxAmount > 0 && amount > target.MaxAmount {
+		amount = target.MaxAmount
+	}
+
+	p.logger.Infof("当前 %s 资产比例 %.2f%%, 偏离目标比例 %.2f%% 超过 %.2f, 准备%s %f",
+		p.symbolPair.BaseAsset.Name, ratio, target.BaseRatio, target.Tolerance, side, amount)
+
+	ticker, err := p.b1client.GetTicker(p.symbolPair.Name)
+	if err != nil {
+		p.logger.Errorf("获取行情数据失败. %s", err)
+		return true
+	}
+
+	if !p.checkTicker(cfg, ticker) {
+		return true
+	}
+
+	askPrice, _ := strconv.ParseFloat(ticker.Data.Ask.Price, 10)
+	bidPrice, _ := strconv.ParseFloat(ticker.Data.Bid.Price, 10)
+	price := p.insidePrice(side, bidPrice, askPrice, target.SpreadPosition)
+
+	// 可用资产不足时按可用资产下单，仍然不足时取消占用该资产的订单
+	p.RLock()
+	if side == BidOrderTypeName {
+		amount = math.Min(amount, p.quoteAvaiable/price)
+	} else {
+		amount = math.Min(amount, p.baseAvaiable)
+	}
+	p.RUnlock()
+
+	if amount <= 0 || amount < target.MinAmount {
+		p.logger.Infof("可用资产不足以平衡到目标比例，尝试取消%s订单", side)
+		if side == BidOrderTypeName {
+			p.cancelOrderChan <- BidOrderType
+		} else {
+			p.cancelOrderChan <- AskOrderType
+		}
+		return true
+	}
+
+	if !p.allowRisk(cfg, side, amount, price) {
+		return true
+	}
+
+	p.placeRebalance(cfg, side, amount, price, p.insidePricer(side, target.SpreadPosition))
+	return true
+}
+
+// 资产恢复后将降低的交易数量恢复为配置的交易数量
+func (p *Exchange) restoreExchangeAmount(cfg *model.Configuration) {
+	p.RLock()
+	var (
+		amount  = p.configAmount
+		enough  = p.baseAvaiable >= amount && p.quoteAvaiable >= p.askPrice*amount
+		lowered = cfg.ExchangeAmount < amount
+	)
+	p.RUnlock()
+
+	if lowered && enough {
+		p.logger.Infof("账户可用资产已恢复，交易数量 %f 恢复为 %f", cfg.ExchangeAmount, amount)
+		p.setExchangeAmount(amount)
+	}
+}
@@ -0,0 +1,182 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/conf"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// 重新加载配置结果
+type ReloadResult struct {
+	Applied  []*model.ConfigChange `json:"applied"`
+	Rejected []*model.ConfigChange `json:"rejected"`
+}
+
+// 获取当前生效的配置
+func (p *Cluster) conf() *model.Configuration {
+	p.RLock()
+	defer p.RUnlock()
+	return p.config
+}
+
+// 替换交易市场配置，正在进行的操作继续使用旧配置，定时任务间隔或执行方式修改时重新调度
+func (p *Exchange) applyConfig(cfg *model.Configuration) {
+	p.Lock()
+	old := p.config
+	p.config = cfg
+	p.configAmount = cfg.ExchangeAmount
+	p.balancePercent = float64(cfg.BalancePercent) / 100.0
+	exchangeEntry, cancelOrderEntry := p.exchangeEntry, p.cancelOrderEntry
+	p.Unlock()
+
+	reschedule(exchangeEntry, old, cfg, old.ExchangeInterval, cfg.ExchangeInterval, model.ScheduleExchange)
+	reschedule(cancelOrderEntry, old, cfg, old.CheckOrderInterval, cfg.CheckOrderInterval, model.ScheduleCancelOrder)
+}
+
+// 替换挖矿限量检查配置
+func (p *limitationChecker) applyConfig(cfg *model.Configuration) {
+	p.Lock()
+	old := p.config
+	p.config = cfg
+	entry := p.checkEntry
+	p.Unlock()
+
+	reschedule(entry, old, cfg, old.CheckLimitationInterval, cfg.CheckLimitationInterval, model.ScheduleCheckLimitation)
+}
+
+// 定时任务的间隔(毫秒)或执行方式修改时重新调度，entry为空时任务没有加入调度器
+func reschedule(entry *scheduler.Entry, old, cfg *model.Configuration, oldInterval, interval int64, job string) {
+	if entry == nil || interval <= 0 {
+		return
+	}
+
+	mode := cfg.ScheduleMode(job)
+	if oldInterval == interval && old.ScheduleMode(job) == mode {
+		return
+	}
+
+	log.Logger.Infof("重新调度定时任务 %s, 间隔: %d毫秒, 执行方式: %s", job, interval, mode)
+	entry.Reschedule(time.Duration(interval)*time.Millisecond, mode)
+}
+
+// 重新加载配置文件，只有全部修改都可以在运行时生效时才应用，否则保持原配置不变
+// source为触发来源，记录到审计日志
+func (p *Cluster) Reload(source string) (*ReloadResult, error) {
+	p.reloading.Lock()
+	defer p.reloading.Unlock()
+
+	var (
+		result = new(ReloadResult)
+		old    = p.conf()
+	)
+
+	cfg, err := conf.Parse(old.ConfigFile)
+	if err != nil {
+		err = fmt.Errorf("加载配置文件失败. %s", err)
+		p.auditReload(source, result, err)
+		return result, err
+	}
+
+	result.Applied, result.Rejected = old.Diff(cfg)
+	if len(result.Rejected) != 0 {
+		var keys = make([]string, 0, len(result.Rejected))
+		for _, c := range result.Rejected {
+			keys = append(keys, c.String())
+		}
+		err = fmt.Errorf("以下配置修改需要重启才能生效: %s", strings.Join(keys, ", "))
+		result.Applied = nil
+		p.auditReload(source, result, err)
+		return result, err
+	}
+
+	if len(result.Applied) == 0 {
+		log.Logger.Infof("配置文件没有修改")
+		p.auditReload(source, result, nil)
+		return result, nil
+	}
+
+	// 只替换有修改的交易市场，未修改的市场保留运行时调整的交易数量
+	var (
+		scopes = make(map[string]bool)
+		cfgs   = cfg.ScopedConfigs()
+	)
+	for _, c := range result.Applied {
+		scopes[c.Scope] = true
+		log.Logger.Infof("应用配置修改 %s", c)
+	}
+
+	p.Lock()
+	p.config = cfg
+	managers := p.managers
+	cross := p.cross
+	p.Unlock()
+
+	p.checker.applyConfig(cfg)
+	if cross != nil {
+		cross.applyConfig(cfg)
+	}
+	for _, mgr := range managers {
+		for _, ex := range mgr.exchanges {
+			scope := ex.conf().Scope()
+			if scopes[scope] {
+				ex.applyConfig(cfgs[scope])
+			}
+		}
+	}
+
+	p.auditReload(source, result, nil)
+	return result, nil
+}
+
+func (p *Cluster) auditReload(source string, result *ReloadResult, err error) {
+	var message string
+	if err != nil {
+		message = err.Error()
+		log.Logger.Errorf("重新加载配置失败. %s", err)
+	}
+
+	log.Audit.Infow("reload",
+		"source", source,
+		"applied", len(result.Applied),
+		"rejected", len(result.Rejected),
+		"message", message)
+}
+
+// 定时检查配置文件修改时间，修改后重新加载配置，config_watch_interval为0时不检查
+func (p *Cluster) WatchConfig() {
+	var (
+		file    = p.conf().ConfigFile
+		modTime time.Time
+	)
+
+	if fi, err := os.Stat(file); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	for {
+		interval := p.conf().ConfigWatchInterval
+		if interval <= 0 {
+			return
+		}
+		time.Sleep(time.Duration(interval) * time.Millisecond)
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			log.Logger.Errorf("检查配置文件失败. %s", err)
+			continue
+		}
+
+		if fi.ModTime().Equal(modTime) {
+			continue
+		}
+
+		modTime = fi.ModTime()
+		log.Logger.Infof("配置文件 %s 已修改，重新加载配置", file)
+		p.Reload("watch")
+	}
+}
@@ -0,0 +1,349 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/metrics"
+	"b1Exchange/pkg/model"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 风险控制，统计净持仓变化、平衡资产花费和已实现盈亏，超过限额时停止交易
+// 成交数量使用下单时返回的已成交数量，下单返回后才成交的数量在补记时计入
+type riskGuard struct {
+	sync.Mutex
+	hourly   *volumeTracker // base为当前小时净买入的base数量
+	daily    *volumeTracker // base为当天净买入的base数量，quote为平衡资产买入花费的quote数量
+	realized *volumeTracker // quote为当天已实现盈亏，扣除手续费
+
+	// 按平均成本统计的持仓，卖出多于买入时为负
+	position float64
+	avgCost  float64
+
+	openOrders int
+	halted     bool
+	reason     string
+	haltedAt   time.Time
+}
+
+// 风险控制状态
+type RiskStatus struct {
+	NetBaseHourly       float64   `json:"net_base_hourly"`
+	NetBaseDaily        float64   `json:"net_base_daily"`
+	RebalanceQuoteDaily float64   `json:"rebalance_quote_daily"`
+	RealizedDaily       float64   `json:"realized_daily"`
+	Position            float64   `json:"position"`
+	AvgCost             float64   `json:"avg_cost"`
+	OpenOrders          int       `json:"open_orders"`
+	Halted              bool      `json:"halted"`
+	Reason              string    `json:"reason,omitempty"`
+	HaltedAt            time.Time `json:"halted_at,omitempty"`
+}
+
+func newRiskGuard() *riskGuard {
+	return &riskGuard{
+		hourly:   newVolumeTracker(model.VolumePeriodHour),
+		daily:    newVolumeTracker(model.VolumePeriodDay),
+		realized: newVolumeTracker(model.VolumePeriodDay),
+	}
+}
+
+// 记录一笔成交，更新净持仓变化和按平均成本计算的已实现盈亏
+func (p *riskGuard) fill(side string, amount, price, feeRate float64) {
+	if amount <= 0 {
+		return
+	}
+
+	var signed = amount
+	if side == AskOrderTypeName {
+		signed = -amount
+	}
+
+	p.hourly.Add(signed, 0)
+	p.daily.Add(signed, 0)
+
+	p.Lock()
+	var pnl = -amount * price * feeRate
+	if p.position == 0 || (p.position > 0) == (signed > 0) {
+		// 加仓
+		total := math.Abs(p.position) + amount
+		p.avgCost = (math.Abs(p.position)*p.avgCost + amount*price) / total
+		p.position += signed
+	} else {
+		// 减仓，超出持仓的部分按成交价反向开仓
+		closed := math.Min(amount, math.Abs(p.position))
+		if p.position > 0 {
+			pnl += closed * (price - p.avgCost)
+		} else {
+			pnl += closed * (p.avgCost - price)
+		}
+		p.position += signed
+		if math.Abs(p.position) < 1e-12 {
+			p.position = 0
+			p.avgCost = 0
+		} else if amount > closed {
+			p.avgCost = price
+		}
+	}
+	p.Unlock()
+
+	p.realized.Add(0, pnl)
+}
+
+// 记录同一账户买卖数量相同的对敲，净持仓不变，已实现盈亏只扣除买卖双方的手续费
+func (p *riskGuard) wash(amount, price, feeRate float64) {
+	if amount <= 0 {
+		return
+	}
+	p.realized.Add(0, -amount*price*feeRate)
+}
+
+// 记录平衡资产买入花费的quote数量
+func (p *riskGuard) spend(quote float64) {
+	p.daily.Add(0, quote)
+}
+
+func (p *riskGuard) setOpenOrders(n int) {
+	p.Lock()
+	p.openOrders = n
+	p.Unlock()
+}
+
+// 检查是否超过限额，返回超过的原因
+func (p *riskGuard) breach(cfg *model.RiskConfig, now time.Time) string {
+	hourlyNet, _ := p.hourly.Get(now)
+	dailyNet, spent := p.daily.Get(now)
+	_, realized := p.realized.Get(now)
+
+	p.Lock()
+	openOrders := p.openOrders
+	p.Unlock()
+
+	switch {
+	case cfg.MaxNetBaseHourly > 0 && math.Abs(hourlyNet) > cfg.MaxNetBaseHourly:
+		return fmt.Sprintf("当前小时净持仓变化 %f 超过 %f", hourlyNet, cfg.MaxNetBaseHourly)
+	case cfg.MaxNetBaseDaily > 0 && math.Abs(dailyNet) > cfg.MaxNetBaseDaily:
+		return fmt.Sprintf("当天净持仓变化 %f 超过 %f", dailyNet, cfg.MaxNetBaseDaily)
+	case cfg.MaxRebalanceQuoteDaily > 0 && spent > cfg.MaxRebalanceQuoteDaily:
+		return fmt.Sprintf("当天平衡资产花费 %f 超过 %f", spent, cfg.MaxRebalanceQuoteDaily)
+	case cfg.MaxRealizedLossDaily > 0 && -realized > cfg.MaxRealizedLossDaily:
+		return fmt.Sprintf("当天已实现亏损 %f 超过 %f", -realized, cfg.MaxRealizedLossDaily)
+	case cfg.MaxOpenOrders > 0 && openOrders > cfg.MaxOpenOrders:
+		return fmt.Sprintf("挂单数量 %d 超过 %d", openOrders, cfg.MaxOpenOrders)
+	}
+	return ""
+}
+
+// 检查是否允许下单，side为空时表示买卖数量相同的对敲，不改变净持仓
+func (p *riskGuard) allow(cfg *model.RiskConfig, side string, amount, price float64) (bool, string) {
+	p.Lock()
+	halted, reason, openOrders := p.halted, p.reason, p.openOrders
+	p.Unlock()
+
+	if halted {
+		return false, "已触发风险控制限额停止交易, " + reason
+	}
+
+	if cfg.MaxOpenOrders > 0 && openOrders >= cfg.MaxOpenOrders {
+		return false, fmt.Sprintf("挂单数量 %d 已达到 %d", openOrders, cfg.MaxOpenOrders)
+	}
+
+	var (
+		now    = time.Now()
+		signed float64
+	)
+
+	switch side {
+	case BidOrderTypeName:
+		signed = amount
+	case AskOrderTypeName:
+		signed = -amount
+	default:
+		return true, ""
+	}
+
+	hourlyNet, _ := p.hourly.Get(now)
+	dailyNet, spent := p.daily.Get(now)
+
+	if cfg.MaxNetBaseHourly > 0 && math.Abs(hourlyNet+signed) > cfg.MaxNetBaseHourly {
+		return false, fmt.Sprintf("当前小时净持仓变化将达到 %f, 超过 %f", hourlyNet+signed, cfg.MaxNetBaseHourly)
+	}
+
+	if cfg.MaxNetBaseDaily > 0 && math.Abs(dailyNet+signed) > cfg.MaxNetBaseDaily {
+		return false, fmt.Sprintf("当天净持仓变化将达到 %f, 超过 %f", dailyNet+signed, cfg.MaxNetBaseDaily)
+	}
+
+	if side == BidOrderTypeName && cfg.MaxRebalanceQuoteDaily > 0 && spent+amount*price > cfg.MaxRebalanceQuoteDaily {
+		return false, fmt.Sprintf("当天平衡资产花费将达到 %f, 超过 %f", spent+amount*price, cfg.MaxRebalanceQuoteDaily)
+	}
+
+	return true, ""
+}
+
+// 停止交易，已经停止时返回false
+func (p *riskGuard) halt(reason string) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.halted {
+		return false
+	}
+	p.halted = true
+	p.reason = reason
+	p.haltedAt = time.Now()
+	return true
+}
+
+func (p *riskGuard) isHalted() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.halted
+}
+
+// 恢复交易，重新开始统计当前周期的净持仓变化、平衡资产花费和已实现盈亏，保留持仓成本
+func (p *riskGuard) reset() {
+	p.hourly.Reset()
+	p.daily.Reset()
+	p.realized.Reset()
+
+	p.Lock()
+	p.halted = false
+	p.reason = ""
+	p.haltedAt = time.Time{}
+	p.Unlock()
+}
+
+func (p *riskGuard) Status() *RiskStatus {
+	var (
+		now = time.Now()
+		s   = new(RiskStatus)
+	)
+
+	s.NetBaseHourly, _ = p.hourly.Get(now)
+	s.NetBaseDaily, s.RebalanceQuoteDaily = p.daily.Get(now)
+	_, s.RealizedDaily = p.realized.Get(now)
+
+	p.Lock()
+	defer p.Unlock()
+	s.Position = p.position
+	s.AvgCost = p.avgCost
+	s.OpenOrders = p.openOrders
+	s.Halted = p.halted
+	s.Reason = p.reason
+	s.HaltedAt = p.haltedAt
+	return s
+}
+
+// 检查是否允许下单，不允许时记录原因
+func (p *Exchange) allowRisk(cfg *model.Configuration, side string, amount, price float64) bool {
+	if !cfg.RiskEnabled() {
+		return true
+	}
+
+	ok, reason := p.risk.allow(cfg.Risk, side, amount, price)
+	if !ok {
+		p.logger.Infof("风险控制禁止下单. %s", reason)
+	}
+	return ok
+}
+
+// 记录订单的已成交数量，平衡资产的买单按下单数量计入花费，之后检查是否超过限额
+func (p *Exchange) recordRisk(cfg *model.Configuration, purpose string, price float64, orders ...*model.Order) {
+	for _, order := range orders {
+		if order == nil {
+			continue
+		}
+
+		var (
+			side      = strings.ToUpper(order.Side)
+			dealPrice = price
+		)
+
+		if avg, err := strconv.ParseFloat(order.AvgDealPrice, 10); err == nil && avg > 0 {
+			dealPrice = avg
+		}
+
+		if filled, err := strconv.ParseFloat(order.FilledAmount, 10); err == nil {
+			p.risk.fill(side, filled, dealPrice, cfg.FeeModel.Rate(false))
+		}
+
+		if purpose == metrics.PurposeBalance && side == BidOrderTypeName {
+			if amount, err := strconv.ParseFloat(order.Amount, 10); err == nil {
+				p.risk.spend(amount * price)
+			}
+		}
+	}
+
+	p.enforceRisk(cfg)
+}
+
+// 记录同一账户对敲的成交数量，挂单一方按maker费率计算手续费，另一方下单时成交按taker费率，
+// late为true时是下单返回后才成交的数量，双方都按maker费率，之后检查是否超过限额
+func (p *Exchange) recordWashRisk(cfg *model.Configuration, price, filled float64, late bool) {
+	p.risk.wash(filled, price, cfg.FeeModel.Rate(true)+cfg.FeeModel.Rate(late))
+	p.enforceRisk(cfg)
+}
+
+// 记录订单下单返回后才成交的数量，按maker费率计算手续费，之后检查是否超过限额
+func (p *Exchange) recordLateRisk(cfg *model.Configuration, side string, amount, price float64) {
+	p.risk.fill(side, amount, price, cfg.FeeModel.Rate(true))
+	p.enforceRisk(cfg)
+}
+
+// 统计挂单数量，订单列表超过一页时继续翻页，超过max_open_orders后不再翻页
+func (p *Exchange) countOpenOrders(cfg *model.Configuration, parms map[string]string, orders *model.OrderList) int {
+	count := len(orders.Edges)
+	if !cfg.RiskEnabled() || cfg.Risk.MaxOpenOrders <= 0 {
+		return count
+	}
+
+	var page = make(map[string]string, len(parms)+1)
+	for k, v := range parms {
+		page[k] = v
+	}
+
+	for orders.PageInfo != nil && orders.PageInfo.HasNextPage && count <= cfg.Risk.MaxOpenOrders {
+		page["after"] = orders.PageInfo.EndCursor
+		resp, err := p.b1client.GetOrders(time.Now().UnixNano(), page)
+		if err != nil {
+			p.logger.Errorf("获取订单列表失败. %s", err)
+			break
+		}
+		if resp.Data == nil {
+			break
+		}
+		orders = resp.Data
+		count += len(orders.Edges)
+	}
+
+	return count
+}
+
+// 超过限额时停止交易并告警
+func (p *Exchange) enforceRisk(cfg *model.Configuration) {
+	if !cfg.RiskEnabled() {
+		return
+	}
+
+	reason := p.risk.breach(cfg.Risk, time.Now())
+	if reason == "" || !p.risk.halt(reason) {
+		return
+	}
+
+	p.logger.Errorf("触发风险控制限额，停止交易. %s", reason)
+	log.Audit.Warnw("risk_halt",
+		"account", cfg.Account,
+		"market", p.symbolPair.Name,
+		"reason", reason)
+	metrics.RiskHalted.WithLabelValues(cfg.Account, p.symbolPair.Name).Set(1)
+}
+
+// 通过控制接口恢复交易
+func (p *Exchange) ResetRisk() {
+	p.risk.reset()
+	metrics.RiskHalted.WithLabelValues(p.conf().Account, p.symbolPair.Name).Set(0)
+	p.logger.Infof("控制接口恢复风险控制停止的交易")
+}
@@ -0,0 +1,291 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"math"
+	"testing"
+	"time"
+)
+
+// 一笔成交，side为空时表示同一账户的对敲
+type riskFill struct {
+	side   string
+	amount float64
+	price  float64
+	rate   float64
+}
+
+func (f riskFill) apply(g *riskGuard) {
+	if f.side == "" {
+		g.wash(f.amount, f.price, f.rate)
+		return
+	}
+	g.fill(f.side, f.amount, f.price, f.rate)
+}
+
+func floatEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRiskGuardFill(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		fills    []riskFill
+		position float64
+		avgCost  float64
+		net      float64
+		realized float64
+	}{
+		{
+			name:     "add to long",
+			fills:    []riskFill{{BidOrderTypeName, 1, 100, 0}, {BidOrderTypeName, 1, 200, 0}},
+			position: 2, avgCost: 150, net: 2,
+		},
+		{
+			name:     "add to short",
+			fills:    []riskFill{{AskOrderTypeName, 1, 100, 0}, {AskOrderTypeName, 3, 120, 0}},
+			position: -4, avgCost: 115, net: -4,
+		},
+		{
+			// 减仓部分按平均成本计算盈亏，超出持仓的部分按成交价反向开仓
+			name:     "reduce through long",
+			fills:    []riskFill{{BidOrderTypeName, 2, 100, 0}, {AskOrderTypeName, 3, 110, 0}},
+			position: -1, avgCost: 110, net: -1, realized: 20,
+		},
+		{
+			name:     "cover short at loss",
+			fills:    []riskFill{{AskOrderTypeName, 1, 100, 0}, {BidOrderTypeName, 1, 120, 0}},
+			position: 0, avgCost: 0, net: 0, realized: -20,
+		},
+		{
+			name:     "partial close keeps cost",
+			fills:    []riskFill{{BidOrderTypeName, 2, 100, 0}, {AskOrderTypeName, 1, 90, 0}},
+			position: 1, avgCost: 100, net: 1, realized: -10,
+		},
+		{
+			name:     "fee",
+			fills:    []riskFill{{BidOrderTypeName, 1, 100, 0.001}, {AskOrderTypeName, 1, 100, 0.002}},
+			position: 0, avgCost: 0, net: 0, realized: -0.3,
+		},
+		{
+			// 对敲不改变持仓，只扣除双方手续费
+			name:     "wash",
+			fills:    []riskFill{{BidOrderTypeName, 1, 100, 0}, {"", 2, 100, 0.003}},
+			position: 1, avgCost: 100, net: 1, realized: -0.6,
+		},
+		{
+			name:  "zero amount",
+			fills: []riskFill{{BidOrderTypeName, 0, 100, 0.001}, {"", 0, 100, 0.001}},
+		},
+	} {
+		g := newRiskGuard()
+		for _, f := range c.fills {
+			f.apply(g)
+		}
+
+		s := g.Status()
+		if !floatEqual(s.Position, c.position) || !floatEqual(s.AvgCost, c.avgCost) {
+			t.Errorf("%s: 持仓 %f 成本 %f, 应为 %f 成本 %f", c.name, s.Position, s.AvgCost, c.position, c.avgCost)
+		}
+		if !floatEqual(s.NetBaseHourly, c.net) || !floatEqual(s.NetBaseDaily, c.net) {
+			t.Errorf("%s: 净持仓变化 %f/%f, 应为 %f", c.name, s.NetBaseHourly, s.NetBaseDaily, c.net)
+		}
+		if !floatEqual(s.RealizedDaily, c.realized) {
+			t.Errorf("%s: 已实现盈亏 %f, 应为 %f", c.name, s.RealizedDaily, c.realized)
+		}
+	}
+}
+
+func TestRiskGuardBreach(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		config *model.RiskConfig
+		fills  []riskFill
+		spent  float64
+		open   int
+		reason string
+	}{
+		{
+			name:   "within limits",
+			config: &model.RiskConfig{MaxNetBaseHourly: 2, MaxNetBaseDaily: 2, MaxRebalanceQuoteDaily: 300, MaxRealizedLossDaily: 20, MaxOpenOrders: 3},
+			fills:  []riskFill{{BidOrderTypeName, 2, 100, 0}, {"", 10, 100, 0.001}},
+			spent:  200,
+			open:   3,
+		},
+		{
+			name:   "hourly net",
+			config: &model.RiskConfig{MaxNetBaseHourly: 1},
+			fills:  []riskFill{{AskOrderTypeName, 2, 100, 0}},
+			reason: "当前小时净持仓变化 -2.000000 超过 1.000000",
+		},
+		{
+			name:   "daily net",
+			config: &model.RiskConfig{MaxNetBaseDaily: 1},
+			fills:  []riskFill{{BidOrderTypeName, 2, 100, 0}},
+			reason: "当天净持仓变化 2.000000 超过 1.000000",
+		},
+		{
+			name:   "rebalance spend",
+			config: &model.RiskConfig{MaxRebalanceQuoteDaily: 50},
+			spent:  100,
+			reason: "当天平衡资产花费 100.000000 超过 50.000000",
+		},
+		{
+			name:   "realized loss",
+			config: &model.RiskConfig{MaxRealizedLossDaily: 5},
+			fills:  []riskFill{{BidOrderTypeName, 1, 100, 0}, {AskOrderTypeName, 1, 90, 0}},
+			reason: "当天已实现亏损 10.000000 超过 5.000000",
+		},
+		{
+			name:   "wash fees",
+			config: &model.RiskConfig{MaxNetBaseHourly: 1, MaxRealizedLossDaily: 5},
+			fills:  []riskFill{{"", 100, 100, 0.001}},
+			reason: "当天已实现亏损 10.000000 超过 5.000000",
+		},
+		{
+			name:   "open orders",
+			config: &model.RiskConfig{MaxOpenOrders: 3},
+			open:   4,
+			reason: "挂单数量 4 超过 3",
+		},
+	} {
+		g := newRiskGuard()
+		for _, f := range c.fills {
+			f.apply(g)
+		}
+		g.spend(c.spent)
+		g.setOpenOrders(c.open)
+
+		if reason := g.breach(c.config, time.Now()); reason != c.reason {
+			t.Errorf("%s: 检查结果 %q, 应为 %q", c.name, reason, c.reason)
+		}
+	}
+}
+
+func TestRiskGuardAllow(t *testing.T) {
+	var config = &model.RiskConfig{MaxNetBaseHourly: 3, MaxNetBaseDaily: 5, MaxRebalanceQuoteDaily: 500, MaxOpenOrders: 10}
+
+	for _, c := range []struct {
+		name   string
+		config *model.RiskConfig
+		fills  []riskFill
+		spent  float64
+		open   int
+		halted bool
+		side   string
+		amount float64
+		allow  bool
+		reason string
+	}{
+		{name: "bid", side: BidOrderTypeName, amount: 3, allow: true},
+		{
+			// 卖出可以减少净持仓变化
+			name:   "ask reduces net",
+			fills:  []riskFill{{BidOrderTypeName, 3, 100, 0}},
+			side:   AskOrderTypeName,
+			amount: 5,
+			allow:  true,
+		},
+		{
+			name:   "hourly net",
+			fills:  []riskFill{{BidOrderTypeName, 2, 100, 0}},
+			side:   BidOrderTypeName,
+			amount: 2,
+			reason: "当前小时净持仓变化将达到 4.000000, 超过 3.000000",
+		},
+		{
+			name:   "daily net",
+			config: &model.RiskConfig{MaxNetBaseDaily: 5},
+			fills:  []riskFill{{AskOrderTypeName, 3, 100, 0}},
+			side:   AskOrderTypeName,
+			amount: 3,
+			reason: "当天净持仓变化将达到 -6.000000, 超过 5.000000",
+		},
+		{
+			name:   "rebalance spend",
+			spent:  450,
+			side:   BidOrderTypeName,
+			amount: 1,
+			reason: "当天平衡资产花费将达到 550.000000, 超过 500.000000",
+		},
+		{
+			// 卖出不花费quote
+			name:   "ask ignores spend",
+			spent:  450,
+			side:   AskOrderTypeName,
+			amount: 1,
+			allow:  true,
+		},
+		{
+			// 对敲不改变净持仓
+			name:   "wash",
+			fills:  []riskFill{{BidOrderTypeName, 3, 100, 0}},
+			spent:  500,
+			amount: 100,
+			allow:  true,
+		},
+		{
+			name:   "open orders",
+			open:   10,
+			amount: 1,
+			reason: "挂单数量 10 已达到 10",
+		},
+		{
+			name:   "halted",
+			halted: true,
+			side:   AskOrderTypeName,
+			amount: 1,
+			reason: "已触发风险控制限额停止交易, test",
+		},
+	} {
+		g := newRiskGuard()
+		for _, f := range c.fills {
+			f.apply(g)
+		}
+		g.spend(c.spent)
+		g.setOpenOrders(c.open)
+		if c.halted {
+			g.halt("test")
+		}
+
+		cfg := c.config
+		if cfg == nil {
+			cfg = config
+		}
+		allow, reason := g.allow(cfg, c.side, c.amount, 100)
+		if allow != c.allow || reason != c.reason {
+			t.Errorf("%s: 检查结果 %v %q, 应为 %v %q", c.name, allow, reason, c.allow, c.reason)
+		}
+	}
+}
+
+func TestRiskGuardReset(t *testing.T) {
+	g := newRiskGuard()
+	g.fill(BidOrderTypeName, 2, 100, 0)
+	g.fill(AskOrderTypeName, 1, 90, 0)
+	g.spend(100)
+	g.setOpenOrders(3)
+
+	if !g.halt("test") {
+		t.Fatalf("第一次停止交易应返回true")
+	}
+	if g.halt("again") {
+		t.Errorf("已经停止时应返回false")
+	}
+
+	g.reset()
+	s := g.Status()
+	if s.Halted || s.Reason != "" || !s.HaltedAt.IsZero() {
+		t.Errorf("恢复后状态 %+v 仍为停止交易", s)
+	}
+	if s.NetBaseHourly != 0 || s.NetBaseDaily != 0 || s.RebalanceQuoteDaily != 0 || s.RealizedDaily != 0 {
+		t.Errorf("恢复后应重新统计, 当前 %+v", s)
+	}
+	// 持仓成本和挂单数量保留
+	if s.Position != 1 || s.AvgCost != 100 || s.OpenOrders != 3 {
+		t.Errorf("恢复后持仓 %f 成本 %f 挂单 %d, 应为 1 100 3", s.Position, s.AvgCost, s.OpenOrders)
+	}
+	if allow, _ := g.allow(&model.RiskConfig{}, BidOrderTypeName, 1, 100); !allow {
+		t.Errorf("恢复后应允许下单")
+	}
+}
@@ -1,17 +1,18 @@
 package exchange
 
 import (
-	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/scheduler"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
-
-	"github.com/freebsdly/tools/timer"
 )
 
 //
 func (p *Exchange) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	p.RLock()
+	defer p.RUnlock()
+
 	s := fmt.Sprintf(`
 	balancePercent  %f
 	baseBalance     %f
@@ -24,60 +25,49 @@ func (p *Exchange) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	limitation      %f
 	keepRunning     %v
 	stat.data       %v
+	yield           %+v
 	`, p.balancePercent, p.baseBalance, p.quoteBalance, p.baseAvaiable, p.quoteAvaiable,
-		p.askPrice, p.bidPrice, p.currentTicker, p.limitation, p.keepRunning, p.stat.Data)
+		p.askPrice, p.bidPrice, p.currentTicker, p.limitation, p.keepRunning, p.stat.Data, p.yield)
 
 	resp.Write([]byte(s))
 }
 
 // TODO 可以设置一个分发器管道，所有信号都放入这个管道，由分发器负责转发，就像akka
-func (p *Exchange) Start() {
-
-	t, err := timer.NewTimer(timer.TIMEWHEEL)
-	if err != nil {
-		log.Logger.Infof("创建调度器失败, %s", err)
-		os.Exit(1)
-	}
-
-	log.Logger.Infof("启动调度器")
-	t.Start()
-
-	log.Logger.Infof("启动交易服务")
+func (p *Exchange) Start(t *scheduler.Scheduler) {
+	p.logger.Infof("启动交易服务")
 	go p.Exchange()
 
-	log.Logger.Infof("启动资产平衡服务")
+	p.logger.Infof("启动资产平衡服务")
 	go p.BalanceAccountBalance()
 
-	log.Logger.Infof("启动取消订单服务")
+	p.logger.Infof("启动取消订单服务")
 	go p.CancelOrders()
 
-	log.Logger.Infof("启动资产检查服务")
+	p.logger.Infof("启动资产检查服务")
 	go p.CheckAccountBalance()
 
-	log.Logger.Infof("启动操作时间统计服务")
+	p.logger.Infof("启动操作时间统计服务")
 	go p.CountTime()
 
-	if p.config.EnableCheckLimitation {
-		log.Logger.Infof("启动检查挖矿限量服务")
-		go p.CheckOneLimitation()
-
-		// 先检查检查一下限额
-		p.checkLimitationChan <- CheckLimitationType
-		now := time.Now()
-		ts := int64(now.Second() + now.Minute()*60)
-		next := 3600 - ts
-
-		log.Logger.Debugf("到下一个小时还有%d秒\n", next)
-
-		t.Add(newRunCheckLimitation(p.checkLimitationChan, CheckLimitationType), uint32(p.config.CheckLimitationInterval/1000), false)
-		t.Add(newRunKeepRunning(t, p.checkLimitationChan, KeepRunningType), uint32(next), true)
-
+	p.logger.Infof("添加定时任务")
+	cfg := p.conf()
+	if cfg.VolumeTargetEnable {
+		p.logger.Infof("启动目标成交量调节服务")
+		go p.PaceExchange()
 	}
 
-	log.Logger.Infof("添加定时任务")
-	t.Add(newRunExchange(p.checkBalanceChan), uint32(p.config.ExchangeInterval/1000), false)
-	t.Add(newRunCancelOrder(p.cancelOrderChan), uint32(p.config.CheckOrderInterval/1000), false)
+	var exchangeEntry *scheduler.Entry
+	if !cfg.VolumeTargetEnable {
+		exchangeEntry = t.Add(newRunExchange(p.checkBalanceChan), time.Duration(cfg.ExchangeInterval)*time.Millisecond,
+			cfg.ScheduleMode(model.ScheduleExchange))
+	}
+	cancelOrderEntry := t.Add(newRunCancelOrder(p.cancelSweepChan), time.Duration(cfg.CheckOrderInterval)*time.Millisecond,
+		cfg.ScheduleMode(model.ScheduleCancelOrder))
 
+	p.Lock()
+	p.exchangeEntry = exchangeEntry
+	p.cancelOrderEntry = cancelOrderEntry
+	p.Unlock()
 }
 
 //
@@ -100,18 +90,21 @@ func (p *runExchange) Stop() error {
 	return nil
 }
 
-func newRunCancelOrder(c chan<- int) *runCancelOrder {
+func newRunCancelOrder(c chan<- chan struct{}) *runCancelOrder {
 	return &runCancelOrder{
 		signChan: c,
 	}
 }
 
+// 定时撤单，等待撤单检查结束后返回，调度器按执行结束时间计算fixed_delay的下一次执行时间
 type runCancelOrder struct {
-	signChan chan<- int
+	signChan chan<- chan struct{}
 }
 
 func (p *runCancelOrder) Run() error {
-	p.signChan <- AllOrderType
+	done := make(chan struct{})
+	p.signChan <- done
+	<-done
 	return nil
 }
 
@@ -119,6 +112,28 @@ func (p *runCancelOrder) Stop() error {
 	return nil
 }
 
+func newRunRebalance(c chan<- chan struct{}) *runRebalance {
+	return &runRebalance{
+		signChan: c,
+	}
+}
+
+// 跨账户资产检查，等待检查和换回结束后返回
+type runRebalance struct {
+	signChan chan<- chan struct{}
+}
+
+func (p *runRebalance) Run() error {
+	done := make(chan struct{})
+	p.signChan <- done
+	<-done
+	return nil
+}
+
+func (p *runRebalance) Stop() error {
+	return nil
+}
+
 type runCheckLimitation struct {
 	signChan chan<- int
 	sign     int
@@ -140,26 +155,21 @@ func newRunCheckLimitation(c chan<- int, sign int) *runCheckLimitation {
 	}
 }
 
-type runKeepRunning struct {
-	tr       timer.Timer
-	sign     int
-	signChan chan<- int
+type runHourCheck struct {
+	checker *limitationChecker
 }
 
-func (p *runKeepRunning) Run() error {
-	p.signChan <- p.sign
-	p.tr.Add(newRunCheckLimitation(p.signChan, p.sign), uint32(3600), false)
+func (p *runHourCheck) Run() error {
+	p.checker.checkHour()
 	return nil
 }
 
-func (p *runKeepRunning) Stop() error {
+func (p *runHourCheck) Stop() error {
 	return nil
 }
 
-func newRunKeepRunning(t timer.Timer, ch chan<- int, si int) *runKeepRunning {
-	return &runKeepRunning{
-		tr:       t,
-		sign:     si,
-		signChan: ch,
+func newRunHourCheck(checker *limitationChecker) *runHourCheck {
+	return &runHourCheck{
+		checker: checker,
 	}
 }
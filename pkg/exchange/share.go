@@ -0,0 +1,312 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/log"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	statTimeLayout = "2006-01-02 15:04:05 -0700"
+
+	// 内存中保留的小时记录数
+	maxShareRecords = 24 * 31
+
+	// 保存当前小时记录的最小时间间隔
+	shareSnapshotInterval = time.Minute
+)
+
+// 每小时挖矿份额记录，全站数据来自交易所统计，自身数据为估算值
+type ShareRecord struct {
+	Hour          time.Time `json:"hour"`
+	TradeMineOne  float64   `json:"trade_mine_one"`
+	InviteMineOne float64   `json:"invite_mine_one"`
+	TotalFeeBtc   float64   `json:"total_fee_btc"`
+	OwnVolume     float64   `json:"own_volume"`
+	OwnFeeBtc     float64   `json:"own_fee_btc"`
+	OwnMineOne    float64   `json:"own_mine_one"`
+	Share         float64   `json:"share"`
+
+	// 是否已经写入文件，从文件加载的记录不再重复写入
+	persisted bool
+}
+
+// 每小时挖矿份额序列，小时结束后追加写入文件，
+// 当前小时的记录定期保存到file.current，重启后恢复，避免重启时丢失当前小时
+type shareHistory struct {
+	sync.RWMutex
+	file    string
+	records []*ShareRecord
+	saved   time.Time
+}
+
+func newShareHistory(file string) *shareHistory {
+	var p = &shareHistory{
+		file: file,
+	}
+
+	if err := p.load(); err != nil {
+		log.Logger.Errorf("加载挖矿份额记录失败. %s", err)
+	}
+
+	if err := p.restore(); err != nil {
+		log.Logger.Errorf("恢复当前小时挖矿份额记录失败. %s", err)
+	}
+
+	return p
+}
+
+func (p *shareHistory) snapshotFile() string {
+	return p.file + ".current"
+}
+
+// 恢复重启前保存的当前小时记录，已经写入文件的小时不再恢复
+func (p *shareHistory) restore() error {
+	data, err := ioutil.ReadFile(p.snapshotFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var r = new(ShareRecord)
+	if err = json.Unmarshal(data, r); err != nil {
+		return fmt.Errorf("解析记录失败. %s, data: %s", err, string(data))
+	}
+
+	if n := len(p.records); n == 0 || p.records[n-1].Hour.Before(r.Hour) {
+		p.records = append(p.records, r)
+		if len(p.records) > maxShareRecords {
+			p.records = p.records[1:]
+		}
+	}
+
+	return nil
+}
+
+// 保存当前小时记录，距离上一次保存不到shareSnapshotInterval且没有进入新的小时时不保存
+func (p *shareHistory) snapshot(r *ShareRecord, now time.Time, force bool) {
+	if !force && now.Sub(p.saved) < shareSnapshotInterval {
+		return
+	}
+	p.saved = now
+
+	data, err := json.Marshal(r)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(p.file), 0755)
+	}
+	if err == nil {
+		tmp := p.snapshotFile() + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, p.snapshotFile())
+		}
+	}
+	if err != nil {
+		log.Logger.Errorf("保存当前小时挖矿份额记录失败. %s", err)
+	}
+}
+
+// 从文件加载历史记录，每行一条json记录
+func (p *shareHistory) load() error {
+	f, err := os.Open(p.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r = new(ShareRecord)
+		if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return fmt.Errorf("解析记录失败. %s, data: %s", err, scanner.Text())
+		}
+		r.persisted = true
+		p.records = append(p.records, r)
+	}
+
+	if len(p.records) > maxShareRecords {
+		p.records = p.records[len(p.records)-maxShareRecords:]
+	}
+
+	return scanner.Err()
+}
+
+// 追加一条已结束小时的记录到文件
+func (p *shareHistory) persist(r *ShareRecord) error {
+	err := os.MkdirAll(filepath.Dir(p.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// 更新当前小时记录，进入新的小时后将上一个小时的记录写入文件
+func (p *shareHistory) Update(r *ShareRecord) {
+	p.Lock()
+	defer p.Unlock()
+
+	n := len(p.records)
+	if n > 0 && p.records[n-1].Hour.Equal(r.Hour) {
+		r.persisted = p.records[n-1].persisted
+		p.records[n-1] = r
+		p.snapshot(r, time.Now(), false)
+		return
+	}
+
+	if last := n - 1; last >= 0 && !p.records[last].persisted && p.records[last].Hour.Before(r.Hour) {
+		if err := p.persist(p.records[last]); err != nil {
+			log.Logger.Errorf("保存挖矿份额记录失败. %s", err)
+		} else {
+			p.records[last].persisted = true
+		}
+	}
+
+	p.records = append(p.records, r)
+	if len(p.records) > maxShareRecords {
+		p.records = p.records[1:]
+	}
+	p.snapshot(r, time.Now(), true)
+}
+
+// 账户的挖矿份额统计，账户下所有交易市场共享，
+// 挖矿按全站手续费分配，自身手续费按账户汇总所有市场后再计算占全站的份额
+type accountShare struct {
+	sync.Mutex
+	history *shareHistory
+	markets map[string]*ShareRecord // 每个交易市场最近一次的估算
+}
+
+func newAccountShare(file string) *accountShare {
+	return &accountShare{
+		history: newShareHistory(file),
+		markets: make(map[string]*ShareRecord),
+	}
+}
+
+// 更新交易市场的估算，汇总同一小时所有市场的自身数据后更新账户记录，返回账户记录
+func (p *accountShare) update(market string, r *ShareRecord) *ShareRecord {
+	p.Lock()
+	defer p.Unlock()
+
+	p.markets[market] = r
+
+	var sum = *r
+	sum.OwnVolume, sum.OwnFeeBtc, sum.OwnMineOne = 0, 0, 0
+	for _, m := range p.markets {
+		if !m.Hour.Equal(r.Hour) {
+			continue
+		}
+		sum.OwnVolume += m.OwnVolume
+		sum.OwnFeeBtc += m.OwnFeeBtc
+		sum.OwnMineOne += m.OwnMineOne
+	}
+
+	if sum.TotalFeeBtc > 0 {
+		sum.Share = sum.OwnFeeBtc / sum.TotalFeeBtc
+	}
+
+	p.history.Update(&sum)
+	return &sum
+}
+
+// 获取所有记录的拷贝
+func (p *shareHistory) Records() []*ShareRecord {
+	p.RLock()
+	defer p.RUnlock()
+
+	var records = make([]*ShareRecord, len(p.records))
+	copy(records, p.records)
+	return records
+}
+
+// 根据交易所统计和收益估算更新账户挖矿份额
+func (p *Exchange) updateShare(yield *yieldEstimate) {
+	if yield == nil {
+		return
+	}
+
+	hour, err := time.Parse(statTimeLayout, yield.StatTime)
+	if err != nil {
+		p.logger.Debugf("解析统计时间 %s 失败, 使用本地时间. %s", yield.StatTime, err)
+		hour = yield.EstimatedTime
+	}
+
+	base, _ := p.hourlyVolume.Get(time.Now())
+
+	var r = &ShareRecord{
+		Hour:          hour.Truncate(time.Hour),
+		TradeMineOne:  yield.MinedOne,
+		InviteMineOne: yield.InviteMineOne,
+		TotalFeeBtc:   yield.TotalFeeBtc,
+		OwnVolume:     base,
+		OwnFeeBtc:     yield.OwnFeeBtc,
+		OwnMineOne:    yield.OwnMinedOne,
+	}
+
+	account := p.share.update(p.symbolPair.Name, r)
+	p.logger.Infof("当前小时账户手续费占比: %2.4f%%", account.Share*100)
+}
+
+// 以json格式输出每小时挖矿份额
+func (p *Exchange) ServeShare(resp http.ResponseWriter, req *http.Request) {
+	if p.share == nil {
+		http.Error(resp, "share tracking disabled", http.StatusNotFound)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(p.share.history.Records())
+}
+
+// 以csv格式导出每小时挖矿份额
+func (p *Exchange) ServeShareCSV(resp http.ResponseWriter, req *http.Request) {
+	if p.share == nil {
+		http.Error(resp, "share tracking disabled", http.StatusNotFound)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/csv")
+	resp.Header().Set("Content-Disposition", "attachment; filename=share.csv")
+
+	w := csv.NewWriter(resp)
+	w.Write([]string{"hour", "trade_mine_one", "invite_mine_one", "total_fee_btc",
+		"own_volume", "own_fee_btc", "own_mine_one", "share"})
+	for _, r := range p.share.history.Records() {
+		w.Write([]string{
+			r.Hour.Format(time.RFC3339),
+			fmt.Sprintf("%f", r.TradeMineOne),
+			fmt.Sprintf("%f", r.InviteMineOne),
+			fmt.Sprintf("%.8f", r.TotalFeeBtc),
+			fmt.Sprintf("%f", r.OwnVolume),
+			fmt.Sprintf("%.8f", r.OwnFeeBtc),
+			fmt.Sprintf("%f", r.OwnMineOne),
+			fmt.Sprintf("%.8f", r.Share),
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,286 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/api"
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"b1Exchange/pkg/version"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// 每个交易市场保留的最近错误数
+	maxRecentErrors = 20
+)
+
+// 错误记录
+type ErrorRecord struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// 最近的错误日志，通过zap的hook记录
+type errorRing struct {
+	sync.Mutex
+	records []ErrorRecord
+}
+
+func (p *errorRing) hook(entry zapcore.Entry) error {
+	if entry.Level < zapcore.ErrorLevel {
+		return nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.records = append(p.records, ErrorRecord{Time: entry.Time, Message: log.Redact(entry.Message)})
+	if len(p.records) > maxRecentErrors {
+		p.records = p.records[len(p.records)-maxRecentErrors:]
+	}
+	return nil
+}
+
+func (p *errorRing) Records() []ErrorRecord {
+	p.Lock()
+	defer p.Unlock()
+
+	var records = make([]ErrorRecord, len(p.records))
+	copy(records, p.records)
+	return records
+}
+
+// 最近一次各个操作的耗时，单位毫秒
+type CycleTimings struct {
+	CheckBalance int64 `json:"check_balance"`
+	Exchange     int64 `json:"exchange"`
+	CancelOrder  int64 `json:"cancel_order"`
+	Balance      int64 `json:"balance"`
+}
+
+// 挖矿限量状态
+type LimitationStatus struct {
+	Limitation    float64 `json:"limitation"`
+	TradeMineOne  float64 `json:"trade_mine_one"`
+	InviteMineOne float64 `json:"invite_mine_one"`
+	TotalFeeBtc   float64 `json:"total_fee_btc"`
+	StatTime      string  `json:"stat_time"`
+	MinedPercent  float64 `json:"mined_percent"`
+	KeepRunning   bool    `json:"keep_running"`
+
+	// 按交易所服务器时间计算的整点重置时间，使用本地时间表示
+	ClockOffset int64     `json:"clock_offset_ms"`
+	LastReset   time.Time `json:"last_reset"`
+	NextReset   time.Time `json:"next_reset"`
+
+	// 当前小时挖矿速度(ONE/秒)和预计下一次检查时的已挖矿比例
+	MinedRate        float64 `json:"mined_rate"`
+	ProjectedPercent float64 `json:"projected_percent"`
+}
+
+// 交易市场状态
+type MarketStatus struct {
+	Market            string            `json:"market"`
+	BaseAsset         string            `json:"base_asset"`
+	QuoteAsset        string            `json:"quote_asset"`
+	BaseBalance       float64           `json:"base_balance"`
+	QuoteBalance      float64           `json:"quote_balance"`
+	BaseAvailable     float64           `json:"base_available"`
+	QuoteAvailable    float64           `json:"quote_available"`
+	AskPrice          float64           `json:"ask_price"`
+	BidPrice          float64           `json:"bid_price"`
+	Ticker            *model.Ticker     `json:"ticker"`
+	ExchangeAmount    float64           `json:"exchange_amount"`
+	ConfiguredAmount  float64           `json:"configured_amount"`
+	BaseRatio         float64           `json:"base_ratio,omitempty"`
+	KeepRunning       bool              `json:"keep_running"`
+	TradingTime       bool              `json:"trading_time"`
+	TradingClosed     string            `json:"trading_closed,omitempty"`
+	ExchangeLocked    bool              `json:"exchange_locked"`
+	CancelOrderLocked bool              `json:"cancel_order_locked"`
+	Paused            bool              `json:"paused"`
+	CancelHeld        bool              `json:"cancel_held"`
+	BalanceHeld       bool              `json:"balance_held"`
+	LastCycle         CycleTimings      `json:"last_cycle"`
+	Yield             *yieldEstimate    `json:"yield,omitempty"`
+	LastExecution     *ExecutionReport  `json:"last_execution,omitempty"`
+	Risk              *RiskStatus       `json:"risk,omitempty"`
+	Pnl               *PnlStatus        `json:"pnl,omitempty"`
+	PriceGuard        *PriceGuardStatus `json:"price_guard"`
+	RecentErrors      []ErrorRecord     `json:"recent_errors"`
+}
+
+// 账户状态
+type AccountStatus struct {
+	Name     string               `json:"name"`
+	Markets  []*MarketStatus      `json:"markets"`
+	Circuits []*api.CircuitStatus `json:"circuits,omitempty"`
+}
+
+// 跨账户对敲状态
+type CrossStatus struct {
+	Market     string  `json:"market"`
+	BidAccount string  `json:"bid_account"`
+	AskAccount string  `json:"ask_account"`
+	Inventory  float64 `json:"inventory"`
+	Reversed   bool    `json:"reversed"`
+}
+
+// 整体状态
+type Status struct {
+	Version    string            `json:"version"`
+	Time       time.Time         `json:"time"`
+	Limitation *LimitationStatus `json:"limitation"`
+	Accounts   []*AccountStatus  `json:"accounts"`
+	Cross      *CrossStatus      `json:"cross,omitempty"`
+
+	// 公共接口客户端的熔断状态
+	Circuits []*api.CircuitStatus `json:"circuits,omitempty"`
+}
+
+// 交易市场状态
+func (p *Exchange) Status() *MarketStatus {
+	p.RLock()
+	defer p.RUnlock()
+
+	var s = &MarketStatus{
+		Market:            p.symbolPair.Name,
+		BaseAsset:         p.symbolPair.BaseAsset.Symbol,
+		QuoteAsset:        p.symbolPair.QuoteAsset.Symbol,
+		BaseBalance:       p.baseBalance,
+		QuoteBalance:      p.quoteBalance,
+		BaseAvailable:     p.baseAvaiable,
+		QuoteAvailable:    p.quoteAvaiable,
+		AskPrice:          p.askPrice,
+		BidPrice:          p.bidPrice,
+		ExchangeAmount:    p.config.ExchangeAmount,
+		ConfiguredAmount:  p.configAmount,
+		KeepRunning:       p.keepRunning,
+		ExchangeLocked:    p.exchangeLocked,
+		CancelOrderLocked: p.cancelOrderLocked,
+		Paused:            p.paused,
+		CancelHeld:        p.cancelHeld,
+		BalanceHeld:       p.balanceHeld,
+		LastCycle:         p.lastCycle,
+		Yield:             p.yield,
+		LastExecution:     p.lastExecution,
+		RecentErrors:      p.errors.Records(),
+	}
+
+	if p.currentTicker != nil {
+		s.Ticker = p.currentTicker.Data
+	}
+
+	s.TradingTime, s.TradingClosed = p.config.TradingAllowed(time.Now())
+
+	s.PriceGuard = p.price.Status(p.config.PriceGuard)
+
+	if mid := (p.askPrice + p.bidPrice) / 2; mid > 0 && p.baseBalance*mid+p.quoteBalance > 0 {
+		s.BaseRatio = p.baseBalance * mid * 100 / (p.baseBalance*mid + p.quoteBalance)
+	}
+
+	if p.config.RiskEnabled() {
+		s.Risk = p.risk.Status()
+	}
+
+	if p.pnl != nil {
+		s.Pnl = p.pnl.Status()
+	}
+
+	return s
+}
+
+// 账户状态
+func (p *Manager) Status() *AccountStatus {
+	var s = &AccountStatus{
+		Name:     p.name,
+		Circuits: p.b1client.CircuitStatus(),
+	}
+
+	for _, ex := range p.exchanges {
+		s.Markets = append(s.Markets, ex.Status())
+	}
+
+	return s
+}
+
+// 挖矿限量状态
+func (p *limitationChecker) Status() *LimitationStatus {
+	p.RLock()
+	defer p.RUnlock()
+
+	var s = &LimitationStatus{
+		Limitation:  p.limitation,
+		KeepRunning: p.keepRunning,
+		ClockOffset: int64(p.clockOffset / time.Millisecond),
+		LastReset:   p.lastReset,
+
+		MinedRate:        p.minedRate,
+		ProjectedPercent: p.projectedPercent,
+	}
+
+	if !p.resetHour.IsZero() {
+		s.NextReset = p.resetHour.Add(time.Hour).Add(-p.clockOffset)
+	}
+
+	if p.stat != nil && p.stat.Data != nil {
+		s.TradeMineOne = p.stat.Data.TradeMineOne
+		s.InviteMineOne = p.stat.Data.InviteMineOne
+		s.TotalFeeBtc = p.stat.Data.TotalFeeBtc
+		s.StatTime = p.stat.Data.StatTime
+		if p.limitation > 0 {
+			s.MinedPercent = (s.TradeMineOne + s.InviteMineOne) * 100.0 / p.limitation
+		}
+	}
+
+	return s
+}
+
+// 跨账户对敲状态
+func (p *crossExchange) Status() *CrossStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	return &CrossStatus{
+		Market:     p.config.SymbolPair,
+		BidAccount: p.config.BidAccount,
+		AskAccount: p.config.AskAccount,
+		Inventory:  p.inventory,
+		Reversed:   p.reversed,
+	}
+}
+
+// 整体状态
+func (p *Cluster) Status() *Status {
+	p.RLock()
+	managers := p.managers
+	cross := p.cross
+	p.RUnlock()
+
+	var s = &Status{
+		Version:    version.Version,
+		Time:       time.Now(),
+		Limitation: p.checker.Status(),
+		Accounts:   make([]*AccountStatus, 0, len(managers)),
+		Circuits:   p.checker.b1client.CircuitStatus(),
+	}
+
+	for _, mgr := range managers {
+		s.Accounts = append(s.Accounts, mgr.Status())
+	}
+
+	if cross != nil {
+		s.Cross = cross.Status()
+	}
+
+	return s
+}
+
+// 以json格式输出整体状态
+func (p *Cluster) ServeStatus(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(p.Status())
+}
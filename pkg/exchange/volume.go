@@ -0,0 +1,275 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 成交量统计，按周期累计已成交的base和quote数量，周期结束后自动清零
+type volumeTracker struct {
+	sync.Mutex
+	period string
+	start  time.Time
+	base   float64
+	quote  float64
+}
+
+func newVolumeTracker(period string) *volumeTracker {
+	var p = &volumeTracker{
+		period: period,
+	}
+	p.start = p.periodStart(time.Now())
+	return p
+}
+
+// 计算now所在周期的开始时间
+func (p *volumeTracker) periodStart(now time.Time) time.Time {
+	if p.period == model.VolumePeriodDay {
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}
+	return now.Truncate(time.Hour)
+}
+
+// 计算now所在周期的结束时间
+func (p *volumeTracker) periodEnd(now time.Time) time.Time {
+	if p.period == model.VolumePeriodDay {
+		return p.periodStart(now).AddDate(0, 0, 1)
+	}
+	return p.periodStart(now).Add(time.Hour)
+}
+
+func (p *volumeTracker) rotate(now time.Time) {
+	start := p.periodStart(now)
+	if !start.Equal(p.start) {
+		p.start = start
+		p.base = 0
+		p.quote = 0
+	}
+}
+
+// 累计成交量
+func (p *volumeTracker) Add(base, quote float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.rotate(time.Now())
+	p.base += base
+	p.quote += quote
+}
+
+// 获取当前周期已成交量
+func (p *volumeTracker) Get(now time.Time) (base, quote float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.rotate(now)
+	return p.base, p.quote
+}
+
+// 清零当前周期已成交量
+func (p *volumeTracker) Reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.start = p.periodStart(time.Now())
+	p.base = 0
+	p.quote = 0
+}
+
+const (
+	// 每次交易前最多查询的未完成对敲轮数，避免占用过多api请求
+	maxReconcileRounds = 5
+
+	// 超过该时间仍未完成的对敲不再查询
+	fillReconcileTTL = time.Hour
+)
+
+// 下单返回时没有完成的一次对敲，订单之后成交时下单返回的已成交数量偏少，需要查询订单补记成交量
+type fillRound struct {
+	orders   []string
+	price    float64
+	recorded float64 // 已记录的成交数量
+	created  time.Time
+	onFill   func(delta float64)
+}
+
+// 等待补记成交量的对敲
+type fillRounds struct {
+	sync.Mutex
+	rounds []*fillRound
+}
+
+// 取出最早的n轮对敲
+func (p *fillRounds) take(n int) []*fillRound {
+	p.Lock()
+	defer p.Unlock()
+	if n > len(p.rounds) {
+		n = len(p.rounds)
+	}
+	var rounds = p.rounds[:n:n]
+	p.rounds = p.rounds[n:]
+	return rounds
+}
+
+func (p *fillRounds) add(rounds ...*fillRound) {
+	p.Lock()
+	defer p.Unlock()
+	p.rounds = append(p.rounds, rounds...)
+}
+
+// 记录一次对敲的成交量，取买卖两个订单中已成交数量较大的一个，
+// 有订单没有完成时之后查询订单补记成交量，onFill在补记时调用
+func (p *Exchange) recordFilled(price float64, onFill func(delta float64), orders ...*model.Order) float64 {
+	var (
+		filled  float64
+		pending bool
+		ids     []string
+	)
+	for _, order := range orders {
+		if order == nil {
+			continue
+		}
+		ids = append(ids, order.Id)
+		if !orderDone(order) {
+			pending = true
+		}
+		amount, err := strconv.ParseFloat(order.FilledAmount, 10)
+		if err != nil {
+			continue
+		}
+		if amount > filled {
+			filled = amount
+		}
+	}
+
+	if filled > 0 {
+		p.volume.Add(filled, filled*price)
+		p.hourlyVolume.Add(filled, filled*price)
+	}
+
+	if pending {
+		p.fills.add(&fillRound{orders: ids, price: price, recorded: filled, created: time.Now(), onFill: onFill})
+	}
+
+	return filled
+}
+
+// 查询下单返回时没有完成的对敲订单，补记之后成交的数量
+func (p *Exchange) reconcileFills() {
+	var keep []*fillRound
+	for _, r := range p.fills.take(maxReconcileRounds) {
+		var (
+			filled float64
+			done   = true
+		)
+		for _, id := range r.orders {
+			order, err := p.b1client.GetOrder(time.Now().UnixNano(), id)
+			if err != nil || order == nil {
+				p.logger.Debugf("查询订单 %s 失败. %v", id, err)
+				done = false
+				continue
+			}
+			if !orderDone(order) {
+				done = false
+			}
+			if amount, err := strconv.ParseFloat(order.FilledAmount, 10); err == nil && amount > filled {
+				filled = amount
+			}
+		}
+
+		if delta := filled - r.recorded; delta > 0 {
+			p.logger.Debugf("补记对敲成交量 %f", delta)
+			p.volume.Add(delta, delta*r.price)
+			p.hourlyVolume.Add(delta, delta*r.price)
+			r.recorded = filled
+			if r.onFill != nil {
+				r.onFill(delta)
+			}
+		}
+
+		if !done && time.Since(r.created) < fillReconcileTTL {
+			keep = append(keep, r)
+		}
+	}
+	p.fills.add(keep...)
+}
+
+// 根据目标成交量、当前周期已成交量和剩余挖矿额度计算下一次交易的间隔，
+// 已达到目标成交量时trade为false，到下一个周期之前不再交易
+func (p *Exchange) nextExchangeInterval(now time.Time) (interval time.Duration, trade bool) {
+	var (
+		cfg         = p.conf()
+		minInterval = time.Duration(cfg.VolumeMinInterval) * time.Millisecond
+		maxInterval = time.Duration(cfg.VolumeMaxInterval) * time.Millisecond
+		done        float64
+		perTrade    float64
+	)
+
+	base, quote := p.volume.Get(now)
+	p.RLock()
+	askPrice := p.askPrice
+	stat := p.stat
+	limitation := p.limitation
+	p.RUnlock()
+
+	if cfg.VolumeTargetUnit == model.VolumeUnitQuote {
+		done = quote
+		perTrade = cfg.ExchangeAmount * askPrice
+	} else {
+		done = base
+		perTrade = cfg.ExchangeAmount
+	}
+
+	remaining := cfg.VolumeTarget - done
+	if remaining <= 0 {
+		p.logger.Debugf("当前周期已成交 %f, 已达到目标成交量 %f, 暂停交易到下一个周期", done, cfg.VolumeTarget)
+		// 最多等待最大间隔后重新检查，运行时调高目标成交量时可以及时恢复交易
+		if left := p.volume.periodEnd(now).Sub(now); left < maxInterval {
+			return left, false
+		}
+		return maxInterval, false
+	}
+
+	// 还没有获取到行情时按固定间隔交易
+	if perTrade <= 0 {
+		return time.Duration(cfg.ExchangeInterval) * time.Millisecond, true
+	}
+
+	left := p.volume.periodEnd(now).Sub(now)
+	interval = time.Duration(float64(left) * perTrade / remaining)
+
+	// 剩余挖矿额度比例低于当前小时剩余时间比例时放慢交易，额度耗尽时按最大间隔交易
+	if cfg.EnableCheckLimitation && stat != nil && stat.Data != nil && limitation > 0 {
+		allowed := limitation * float64(cfg.OneHourlyLimitationPercent) / 100.0
+		allowance := (allowed - stat.Data.TradeMineOne - stat.Data.InviteMineOne) / allowed
+		timeRatio := float64(now.Truncate(time.Hour).Add(time.Hour).Sub(now)) / float64(time.Hour)
+		if allowance <= 0 {
+			return maxInterval, true
+		}
+		if allowance < timeRatio {
+			interval = time.Duration(float64(interval) * timeRatio / allowance)
+		}
+	}
+
+	if interval < minInterval {
+		interval = minInterval
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+
+	p.logger.Debugf("当前周期已成交 %f, 目标 %f, 下一次交易间隔 %d 毫秒",
+		done, cfg.VolumeTarget, interval/time.Millisecond)
+	return interval, true
+}
+
+// 按目标成交量调节交易频率
+func (p *Exchange) PaceExchange() {
+	for {
+		interval, trade := p.nextExchangeInterval(time.Now())
+		time.Sleep(interval)
+		if trade {
+			p.checkBalanceChan <- NormalExchangeType
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package exchange
+
+import (
+	"b1Exchange/pkg/model"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 每小时挖矿收益估算
+type yieldEstimate struct {
+	StatTime      string    `json:"stat_time"`       // 交易所统计时间
+	TotalFeeBtc   float64   `json:"total_fee_btc"`   // 全站当前小时手续费，折合BTC
+	MinedOne      float64   `json:"mined_one"`       // 全站当前小时挖矿ONE数量
+	InviteMineOne float64   `json:"invite_mine_one"` // 全站当前小时邀请奖励ONE数量
+	OnePriceBtc   float64   `json:"one_price_btc"`   // ONE价格，以BTC计价
+	OnePriceQuote float64   `json:"one_price_quote"` // ONE价格，以计价资产计价
+	RewardPerFee  float64   `json:"reward_per_fee"`  // 每单位手续费换来的挖矿ONE价值，即 MinedOne*OnePriceBtc/TotalFeeBtc
+	OwnFeeBtc     float64   `json:"own_fee_btc"`     // 自身当前小时手续费估算，折合BTC
+	OwnMinedOne   float64   `json:"own_mined_one"`   // 自身当前小时挖矿ONE估算
+	Profitable    bool      `json:"profitable"`      // 是否继续交易
+	EstimatedTime time.Time `json:"estimated_time"`  // 估算时间
+}
+
+// 获取交易对的最新成交价
+func (p *Exchange) lastPrice(market string) (float64, error) {
+	ticker, err := p.b1client.GetTicker(market)
+	if err != nil {
+		return 0, err
+	}
+
+	if ticker.Data == nil {
+		return 0, fmt.Errorf("交易对 %s 行情为空", market)
+	}
+
+	return strconv.ParseFloat(ticker.Data.Close, 10)
+}
+
+// 计算计价资产换算成BTC的比例
+func (p *Exchange) quoteToBtc() (float64, error) {
+	cfg := p.conf()
+	if cfg.BtcPriceMarket == "" {
+		return 1, nil
+	}
+
+	price, err := p.lastPrice(cfg.BtcPriceMarket)
+	if err != nil {
+		return 0, err
+	}
+
+	if price <= 0 {
+		return 0, fmt.Errorf("交易对 %s 价格为0", cfg.BtcPriceMarket)
+	}
+
+	return 1 / price, nil
+}
+
+// 估算当前小时的挖矿收益，返回nil表示无法估算
+func (p *Exchange) estimateYield(stat *model.OneHourlyLimitationResponeBody) *yieldEstimate {
+	if stat == nil || stat.Data == nil {
+		return nil
+	}
+
+	cfg := p.conf()
+	onePrice, err := p.lastPrice(cfg.OnePriceMarket)
+	if err != nil {
+		p.logger.Errorf("获取ONE价格失败. %s", err)
+		return nil
+	}
+
+	rate, err := p.quoteToBtc()
+	if err != nil {
+		p.logger.Errorf("获取BTC价格失败. %s", err)
+		return nil
+	}
+
+	_, quote := p.hourlyVolume.Get(time.Now())
+
+	var est = &yieldEstimate{
+		StatTime:      stat.Data.StatTime,
+		TotalFeeBtc:   stat.Data.TotalFeeBtc,
+		MinedOne:      stat.Data.TradeMineOne,
+		InviteMineOne: stat.Data.InviteMineOne,
+		OnePriceBtc:   onePrice,
+		OnePriceQuote: onePrice / rate,
+		OwnFeeBtc:     quote * (cfg.FeeModel.Rate(true) + cfg.FeeModel.Rate(false)) * rate, // 对敲买卖双方都要支付手续费，一方挂单一方吃单
+		Profitable:    true,
+		EstimatedTime: time.Now(),
+	}
+
+	if est.TotalFeeBtc > 0 {
+		est.RewardPerFee = est.MinedOne * est.OnePriceBtc / est.TotalFeeBtc
+		est.OwnMinedOne = est.MinedOne * est.OwnFeeBtc / est.TotalFeeBtc
+		est.Profitable = est.RewardPerFee >= cfg.ProfitMinRewardRatio
+	}
+
+	p.logger.Infof("当前小时全站手续费: %f BTC, 挖矿: %f ONE, ONE价格: %.8f BTC, 收益手续费比: %f",
+		est.TotalFeeBtc, est.MinedOne, est.OnePriceBtc, est.RewardPerFee)
+	p.logger.Infof("当前小时自身手续费估算: %f BTC, 挖矿估算: %f ONE", est.OwnFeeBtc, est.OwnMinedOne)
+
+	return est
+}
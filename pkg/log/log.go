@@ -10,6 +10,9 @@ import (
 
 var (
 	Logger *zap.SugaredLogger
+
+	// 审计日志，记录通过控制接口进行的操作
+	Audit *zap.SugaredLogger
 )
 
 func Init(logfile, loglevel string) {
@@ -26,7 +29,7 @@ func Init(logfile, loglevel string) {
 	case "INFO":
 		cfg.Level.SetLevel(zap.InfoLevel)
 		break
-	case "WARNNING":
+	case "WARNNING", "WARNING":
 		cfg.Level.SetLevel(zap.WarnLevel)
 		break
 	case "ERROR":
@@ -38,9 +41,23 @@ func Init(logfile, loglevel string) {
 	}
 
 	var err error
-	logger, err = cfg.Build()
+	logger, err = cfg.Build(wrapRedact())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "build log failed. %s\n", err)
 	}
 	Logger = logger.Sugar()
 }
+
+// 初始化审计日志，审计日志总是记录info级别
+func InitAudit(logfile string) {
+	var cfg = zap.NewProductionConfig()
+	cfg.OutputPaths = []string{logfile}
+	cfg.Sampling = nil
+
+	logger, err := cfg.Build(wrapRedact())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build audit log failed. %s\n", err)
+		logger = zap.NewNop()
+	}
+	Audit = logger.Sugar()
+}
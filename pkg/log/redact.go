@@ -0,0 +1,79 @@
+package log
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 日志中密钥替换为该值
+const redactedValue = "******"
+
+var (
+	secretsLock sync.RWMutex
+	secrets     []string
+)
+
+// 设置需要从日志中隐藏的密钥
+func SetSecrets(values ...string) {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	secrets = secrets[:0]
+	for _, v := range values {
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// 将s中的密钥替换为******
+func Redact(s string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+
+	for _, v := range secrets {
+		s = strings.Replace(s, v, redactedValue, -1)
+	}
+	return s
+}
+
+// 写日志前隐藏消息和字符串字段中的密钥
+type redactCore struct {
+	zapcore.Core
+}
+
+func wrapRedact() zap.Option {
+	return zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &redactCore{c}
+	})
+}
+
+func (p *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{p.Core.With(redactFields(fields))}
+}
+
+func (p *redactCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if p.Enabled(entry.Level) {
+		return ce.AddCore(entry, p)
+	}
+	return ce
+}
+
+func (p *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = Redact(entry.Message)
+	return p.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	var redacted = make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		if f.Type == zapcore.StringType {
+			f.String = Redact(f.String)
+		}
+		redacted[i] = f
+	}
+	return redacted
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "b1exchange"
+
+// 操作名称
+const (
+	OperationCheckBalance = "check_balance"
+	OperationTrade        = "trade"
+	OperationCancel       = "cancel"
+	OperationRebalance    = "rebalance"
+)
+
+// 下单用途
+const (
+	PurposeExchange = "exchange" // 对敲
+	PurposeBalance  = "balance"  // 平衡资产
+	PurposeCross    = "cross"    // 跨账户对敲
+	PurposeStale    = "stale"    // 取消超时订单
+)
+
+var (
+	// 各个操作的耗时
+	OperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of check balance, trade, cancel and rebalance operations.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"account", "market", "operation"})
+
+	// 订单数，result为 created/failed/cancelled/cancel_failed
+	Orders = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_total",
+		Help:      "Orders created, cancelled or failed by side and purpose.",
+	}, []string{"account", "market", "side", "purpose", "result"})
+
+	// api请求数，account为客户端名称，公共接口客户端为public，status为http状态码，请求失败时为error
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "BigONE API requests by account, endpoint and status.",
+	}, []string{"account", "endpoint", "status"})
+
+	// 资产余额，kind为 total/available
+	Balance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "balance",
+		Help:      "Account balance of the market assets.",
+	}, []string{"account", "market", "asset", "kind"})
+
+	// 卖一价与买一价的差价
+	Spread = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spread",
+		Help:      "Difference between best ask and best bid price.",
+	}, []string{"account", "market"})
+
+	// 当前小时已挖矿量占限额的百分比
+	MinedPercent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mined_percent",
+		Help:      "Percentage of the hourly mining limitation already mined.",
+	}, []string{"account", "market"})
+
+	// 是否触发风险控制限额停止交易，1为已停止
+	RiskHalted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "risk_halted",
+		Help:      "Whether trading of the market is halted by a risk limit.",
+	}, []string{"account", "market"})
+
+	// api熔断状态，0为关闭，1为半开，2为打开
+	CircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "api_circuit_state",
+		Help:      "API circuit breaker state by client and endpoint, 0 closed, 1 half open, 2 open.",
+	}, []string{"client", "endpoint"})
+
+	// 当天盈亏，以quote计价，component为wash_fee/rebalance_fee/rebalance_slippage/mining_revenue/net
+	PnlToday = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pnl_today",
+		Help:      "Profit and loss of the current day in quote currency by component.",
+	}, []string{"account", "market", "component"})
+)
+
+func init() {
+	prometheus.MustRegister(OperationDuration, Orders, APIRequests, Balance, Spread, MinedPercent, RiskHalted,
+		CircuitState, PnlToday)
+}
+
+// /metrics 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// 将请求路径转换为api名称，去掉路径中的交易对和订单id，避免标签数量过多
+// 例如 /api/v2/markets/ONE-USDT/ticker 转换为 markets/:id/ticker
+func Endpoint(base, path string) string {
+	path = strings.Trim(strings.TrimPrefix(path, base), "/")
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if (parts[i-1] == "markets" || parts[i-1] == "orders") && parts[i] != "cancel_all" {
+			parts[i] = ":id"
+		}
+	}
+	return strings.Join(parts, "/")
+}
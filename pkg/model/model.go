@@ -1,11 +1,28 @@
 package model
 
 import (
+	"b1Exchange/pkg/scheduler"
 	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	DefaultAccountName = "default"
+)
+
+const (
+	VolumeUnitBase  = "BASE"
+	VolumeUnitQuote = "QUOTE"
+
+	VolumePeriodHour = "HOUR"
+	VolumePeriodDay  = "DAY"
+)
+
 const (
 	OrderPendingState  = "PENDING"
 	OrderFilledState   = "FILLED"
@@ -39,43 +56,1258 @@ type Configuration struct {
 	BalanceLockCancelOrder       bool     `yaml:"balance_lock_cancel_order"`
 	LogFile                      string   `yaml:"log_file"`
 	LogLevel                     string   `yaml:"log_level"`
+	VolumeTargetEnable           bool     `yaml:"volume_target_enable"`
+	VolumeTarget                 float64  `yaml:"volume_target"`
+	VolumeTargetUnit             string   `yaml:"volume_target_unit"`
+	VolumeTargetPeriod           string   `yaml:"volume_target_period"`
+	VolumeMinInterval            int64    `yaml:"volume_min_interval"`
+	VolumeMaxInterval            int64    `yaml:"volume_max_interval"`
+	ProfitStopEnable             bool     `yaml:"profit_stop_enable"`
+	ProfitMinRewardRatio         float64  `yaml:"profit_min_reward_ratio"`
+	FeeRate                      float64  `yaml:"fee_rate"`
+	OnePriceMarket               string   `yaml:"one_price_market"`
+	BtcPriceMarket               string   `yaml:"btc_price_market"`
+	ShareTrackEnable             bool     `yaml:"share_track_enable"`
+	ShareHistoryFile             string   `yaml:"share_history_file"`
+	OwnedOrdersFile              string   `yaml:"owned_orders_file"`
+	RequestRateLimit             int      `yaml:"request_rate_limit"`
+	ControlToken                 string   `yaml:"control_token"`
+	AuditLogFile                 string   `yaml:"audit_log_file"`
+	ConfigWatchInterval          int64    `yaml:"config_watch_interval"`
+	SecretsFile                  string   `yaml:"secrets_file"`
+	PredictiveStopEnable         bool     `yaml:"predictive_stop_enable"`
+	PredictiveStopFactor         float64  `yaml:"predictive_stop_factor"`
+
+	// 多市场配置，为空时只交易symbol_pair
+	Markets []*MarketConfig `yaml:"markets"`
+
+	// 多账户配置，为空时只使用appkey和appsecret对应的账户
+	Accounts []*AccountConfig `yaml:"accounts"`
+
+	// 跨账户对敲配置
+	Cross *CrossConfig `yaml:"cross_exchange"`
+
+	// 状态接口http服务配置
+	HTTP *HTTPConfig `yaml:"http_server"`
+
+	// 定时任务执行方式，key为任务名称，value为fixed_rate或fixed_delay
+	ScheduleModes map[string]string `yaml:"schedule_modes"`
+
+	// 交易时间窗口和停止交易时间段
+	TradingTime *TradingTimeConfig `yaml:"trading_time"`
+
+	// 风险控制限额
+	Risk *RiskConfig `yaml:"risk"`
+
+	// 行情异常检查
+	PriceGuard *PriceGuardConfig `yaml:"price_guard"`
+
+	// api请求熔断
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// 按目标资产比例平衡资产
+	RebalanceTarget *RebalanceTargetConfig `yaml:"rebalance_target"`
+
+	// 平衡资产订单执行方式
+	RebalanceExecution *RebalanceExecutionConfig `yaml:"rebalance_execution"`
+
+	// 取消超时订单的策略
+	CancelPolicy *CancelPolicyConfig `yaml:"cancel_policy"`
+
+	// 手续费模型，未配置时maker和taker手续费率都使用fee_rate
+	FeeModel *FeeModelConfig `yaml:"fee_model"`
+
+	// 盈亏统计
+	Pnl *PnlConfig `yaml:"pnl"`
+
+	// 账户名称，由AccountConfigs生成，不从配置文件读取
+	Account string `yaml:"-"`
+
+	// 配置文件路径，重新加载配置时使用
+	ConfigFile string `yaml:"-"`
+
+	// 由trading_time生成的交易日历，为空时任何时间都可以交易
+	Calendar *scheduler.Calendar `yaml:"-"`
+}
+
+// 交易时间配置，windows为cron表达式，时区默认使用本地时区
+type TradingTimeConfig struct {
+	Timezone  string            `yaml:"timezone"`
+	Windows   []string          `yaml:"windows"`
+	Blackouts []*BlackoutConfig `yaml:"blackouts"`
+}
+
+// 停止交易时间段，使用start和end指定一次性的时间段，或使用cron指定周期性的时间段
+type BlackoutConfig struct {
+	Name  string `yaml:"name"`
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	Cron  string `yaml:"cron"`
+}
+
+// 停止交易时间段的时间格式
+const BlackoutTimeLayout = "2006-01-02 15:04"
+
+// 检查交易时间配置并生成交易日历
+func (p *Configuration) checkTradingTime(errs *ConfigErrors) {
+	p.Calendar = nil
+	if p.TradingTime == nil {
+		return
+	}
+
+	var (
+		loc       = time.Local
+		windows   []*scheduler.Cron
+		blackouts []*scheduler.Period
+		err       error
+		count     = len(*errs)
+	)
+
+	// 时区错误时仍使用本地时区检查其他配置
+	if p.TradingTime.Timezone != "" {
+		if l, err := time.LoadLocation(p.TradingTime.Timezone); err != nil {
+			errs.add("trading_time 的timezone %s 错误. %s", p.TradingTime.Timezone, err)
+		} else {
+			loc = l
+		}
+	}
+
+	for _, w := range p.TradingTime.Windows {
+		c, err := scheduler.ParseCron(w)
+		if err != nil {
+			errs.add("trading_time 的windows错误. %s", err)
+			continue
+		}
+		windows = append(windows, c)
+	}
+
+	for i, b := range p.TradingTime.Blackouts {
+		var period = &scheduler.Period{Name: b.Name}
+		if period.Name == "" {
+			period.Name = fmt.Sprintf("blackout-%d", i+1)
+		}
+
+		if b.Cron != "" {
+			if b.Start != "" || b.End != "" {
+				errs.add("trading_time 的blackouts %s 不能同时设置cron和start/end", period.Name)
+				continue
+			}
+			if period.Cron, err = scheduler.ParseCron(b.Cron); err != nil {
+				errs.add("trading_time 的blackouts %s 错误. %s", period.Name, err)
+				continue
+			}
+			blackouts = append(blackouts, period)
+			continue
+		}
+
+		period.Start, err = time.ParseInLocation(BlackoutTimeLayout, b.Start, loc)
+		if err != nil {
+			errs.add("trading_time 的blackouts %s 的start格式必须为 %s", period.Name, BlackoutTimeLayout)
+			continue
+		}
+		period.End, err = time.ParseInLocation(BlackoutTimeLayout, b.End, loc)
+		if err != nil {
+			errs.add("trading_time 的blackouts %s 的end格式必须为 %s", period.Name, BlackoutTimeLayout)
+			continue
+		}
+		if !period.End.After(period.Start) {
+			errs.add("trading_time 的blackouts %s 的end必须晚于start", period.Name)
+			continue
+		}
+		blackouts = append(blackouts, period)
+	}
+
+	if len(*errs) == count {
+		p.Calendar = scheduler.NewCalendar(loc, windows, blackouts)
+	}
+}
+
+// 判断t是否在交易时间内，不在时返回原因
+func (p *Configuration) TradingAllowed(t time.Time) (bool, string) {
+	if p.Calendar == nil {
+		return true, ""
+	}
+	return p.Calendar.Allowed(t)
+}
+
+// 定时任务名称
+const (
+	ScheduleExchange        = "exchange"
+	ScheduleCancelOrder     = "cancel_order"
+	ScheduleCheckLimitation = "check_limitation"
+	ScheduleCrossExchange   = "cross_exchange"
+	ScheduleCrossRebalance  = "cross_rebalance"
+)
+
+// 定时任务默认执行方式，撤单检查在上一次检查结束后再开始
+var defaultScheduleModes = map[string]scheduler.Mode{
+	ScheduleExchange:        scheduler.FixedRate,
+	ScheduleCancelOrder:     scheduler.FixedDelay,
+	ScheduleCheckLimitation: scheduler.FixedRate,
+	ScheduleCrossExchange:   scheduler.FixedRate,
+	ScheduleCrossRebalance:  scheduler.FixedDelay,
+}
+
+// 等待执行结束后才返回的定时任务，其他任务只发出执行信号，不能使用fixed_delay
+var waitingScheduleJobs = map[string]bool{
+	ScheduleCancelOrder:    true,
+	ScheduleCrossRebalance: true,
+}
+
+// 获取定时任务的执行方式
+func (p *Configuration) ScheduleMode(job string) scheduler.Mode {
+	if v, ok := p.ScheduleModes[job]; ok {
+		if mode, err := scheduler.ParseMode(v); err == nil {
+			return mode
+		}
+	}
+	return defaultScheduleModes[job]
+}
+
+// 检查定时任务执行方式配置
+func (p *Configuration) checkScheduleModes(errs *ConfigErrors) {
+	for job, v := range p.ScheduleModes {
+		if _, ok := defaultScheduleModes[job]; !ok {
+			errs.add("schedule_modes 中的任务 %s 不存在", job)
+			continue
+		}
+		mode, err := scheduler.ParseMode(v)
+		if err != nil {
+			errs.add("schedule_modes 中任务 %s 的%s", job, err)
+			continue
+		}
+		if mode == scheduler.FixedDelay && !waitingScheduleJobs[job] {
+			errs.add("schedule_modes 中任务 %s 只发出执行信号，不能使用 %s", job, scheduler.FixedDelayName)
+		}
+	}
+}
+
+// 风险控制配置，每个交易市场单独统计，限额为0时不检查该项
+type RiskConfig struct {
+	Enable                 bool    `yaml:"enable"`
+	MaxNetBaseHourly       float64 `yaml:"max_net_base_hourly"`
+	MaxNetBaseDaily        float64 `yaml:"max_net_base_daily"`
+	MaxRebalanceQuoteDaily float64 `yaml:"max_rebalance_quote_daily"`
+	MaxRealizedLossDaily   float64 `yaml:"max_realized_loss_daily"`
+	MaxOpenOrders          int     `yaml:"max_open_orders"`
+}
+
+// 是否开启风险控制
+func (p *Configuration) RiskEnabled() bool {
+	return p.Risk != nil && p.Risk.Enable
+}
+
+// 检查风险控制配置
+func (p *Configuration) checkRisk(errs *ConfigErrors) {
+	if !p.RiskEnabled() {
+		return
+	}
+
+	if p.Risk.MaxNetBaseHourly < 0 || p.Risk.MaxNetBaseDaily < 0 ||
+		p.Risk.MaxRebalanceQuoteDaily < 0 || p.Risk.MaxRealizedLossDaily < 0 || p.Risk.MaxOpenOrders < 0 {
+		errs.add("risk 中的限额不能小于0")
+	}
+
+	// 挂单数量由撤单检查时获取的PENDING订单统计，超过check_order_number时翻页统计
+	if p.Risk.MaxOpenOrders > 0 {
+		var pending bool
+		for _, v := range p.CancelOrderTypes {
+			if strings.ToUpper(v) == OrderPendingState {
+				pending = true
+			}
+		}
+		if !pending {
+			errs.add("risk 的max_open_orders 需要check_order_type包含%s", OrderPendingState)
+		}
+	}
+}
+
+// 行情异常检查配置，各项为0时不检查该项
+// 价格为空或为0、买一价不低于卖一价时总是认为行情异常
+type PriceGuardConfig struct {
+	ReferenceWindow     int64   `yaml:"reference_window"`
+	MaxDeviationPercent float64 `yaml:"max_deviation_percent"`
+	MinBookAmount       float64 `yaml:"min_book_amount"`
+	StaleTickerTime     int64   `yaml:"stale_ticker_time"`
+	RecoverCount        int     `yaml:"recover_count"`
+}
+
+// 检查行情异常检查配置，未配置时只检查价格是否有效
+func (p *Configuration) checkPriceGuard(errs *ConfigErrors) {
+	if p.PriceGuard == nil {
+		p.PriceGuard = new(PriceGuardConfig)
+	}
+
+	if p.PriceGuard.ReferenceWindow < 0 || p.PriceGuard.MaxDeviationPercent < 0 ||
+		p.PriceGuard.MinBookAmount < 0 || p.PriceGuard.StaleTickerTime < 0 || p.PriceGuard.RecoverCount < 0 {
+		errs.add("price_guard 中的配置不能小于0")
+	}
+
+	if p.PriceGuard.MaxDeviationPercent > 0 && p.PriceGuard.ReferenceWindow == 0 {
+		errs.add("price_guard 的max_deviation_percent 需要设置reference_window")
+	}
+
+	if p.PriceGuard.RecoverCount == 0 {
+		p.PriceGuard.RecoverCount = 1
+	}
+}
+
+// api请求熔断配置，每个api客户端按接口分别统计请求失败次数
+type CircuitBreakerConfig struct {
+	Disable             bool    `yaml:"disable"`
+	ConsecutiveFailures int     `yaml:"consecutive_failures"`
+	Window              int64   `yaml:"window"`
+	FailureRate         float64 `yaml:"failure_rate"`
+	MinRequests         int     `yaml:"min_requests"`
+	OpenTime            int64   `yaml:"open_time"`
+	HalfOpenProbes      int     `yaml:"half_open_probes"`
+}
+
+// 检查熔断配置并设置默认值，未配置时使用默认值开启熔断
+func (p *Configuration) checkCircuitBreaker(errs *ConfigErrors) {
+	if p.CircuitBreaker == nil {
+		p.CircuitBreaker = new(CircuitBreakerConfig)
+	}
+
+	var c = p.CircuitBreaker
+	if c.Disable {
+		return
+	}
+
+	if c.ConsecutiveFailures < 0 || c.Window < 0 || c.FailureRate < 0 || c.MinRequests < 0 ||
+		c.OpenTime < 0 || c.HalfOpenProbes < 0 {
+		errs.add("circuit_breaker 中的配置不能小于0")
+	}
+
+	if c.FailureRate > 100 {
+		errs.add("circuit_breaker 的failure_rate 失败百分比不能大于100")
+	}
+
+	if c.ConsecutiveFailures == 0 {
+		c.ConsecutiveFailures = 5
+	}
+
+	if c.Window == 0 {
+		c.Window = 60000
+	}
+
+	if c.FailureRate == 0 {
+		c.FailureRate = 50
+	}
+
+	if c.MinRequests == 0 {
+		c.MinRequests = 10
+	}
+
+	if c.OpenTime == 0 {
+		c.OpenTime = 30000
+	}
+
+	if c.HalfOpenProbes == 0 {
+		c.HalfOpenProbes = 1
+	}
+}
+
+// 目标资产比例配置，base_ratio为base资产价值占总资产价值的百分比，
+// 偏离超过tolerance个百分点时在买一卖一价之间挂限价单平衡到目标比例
+type RebalanceTargetConfig struct {
+	Enable         bool    `yaml:"enable"`
+	BaseRatio      float64 `yaml:"base_ratio"`
+	Tolerance      float64 `yaml:"tolerance"`
+	SpreadPosition float64 `yaml:"spread_position"`
+	MinAmount      float64 `yaml:"min_amount"`
+	MaxAmount      float64 `yaml:"max_amount"`
+}
+
+// 是否按目标资产比例平衡资产
+func (p *Configuration) RebalanceTargetEnabled() bool {
+	return p.RebalanceTarget != nil && p.RebalanceTarget.Enable
+}
+
+// 检查目标资产比例配置
+func (p *Configuration) checkRebalanceTarget(errs *ConfigErrors) {
+	if !p.RebalanceTargetEnabled() {
+		return
+	}
+
+	var c = p.RebalanceTarget
+	if !p.BalanceAccountBalance {
+		errs.add("rebalance_target 需要开启balance_account_balance")
+	}
+
+	if c.BaseRatio <= 0 || c.BaseRatio >= 100 {
+		errs.add("rebalance_target 的base_ratio 目标比例必须大于0,同时小于100")
+	}
+
+	if c.Tolerance <= 0 || c.Tolerance >= c.BaseRatio || c.Tolerance >= 100-c.BaseRatio {
+		errs.add("rebalance_target 的tolerance 必须大于0,同时小于base_ratio和100-base_ratio")
+	}
+
+	if c.SpreadPosition == 0 {
+		c.SpreadPosition = 50
+	}
+
+	if c.SpreadPosition < 0 || c.SpreadPosition > 100 {
+		errs.add("rebalance_target 的spread_position 必须大于0,同时小于等于100")
+	}
+
+	if c.MinAmount < 0 || c.MaxAmount < 0 {
+		errs.add("rebalance_target 的min_amount和max_amount不能小于0")
+	}
+
+	if c.MaxAmount > 0 && c.MaxAmount < c.MinAmount {
+		errs.add("rebalance_target 的max_amount不能小于min_amount")
+	}
+}
+
+const (
+	ExecutionDirect  = "direct"  // 一次下单
+	ExecutionTWAP    = "twap"    // 按时间拆分下单
+	ExecutionIceberg = "iceberg" // 每次只挂出一部分
+)
+
+// 平衡资产订单执行配置，拆分后的子订单在等待时间内没有完全成交时取消，剩余数量按最新行情重新下单
+type RebalanceExecutionConfig struct {
+	Mode            string  `yaml:"mode"`
+	Slices          int     `yaml:"slices"`
+	Duration        int64   `yaml:"duration"`
+	SliceAmount     float64 `yaml:"slice_amount"`
+	RepriceInterval int64   `yaml:"reprice_interval"`
+	MaxReprices     int     `yaml:"max_reprices"`
+}
+
+// 子订单的最小等待时间，单位毫秒
+const MinExecutionInterval = 1000
+
+// 检查平衡资产订单执行配置，未配置时一次下单
+func (p *Configuration) checkRebalanceExecution(errs *ConfigErrors) {
+	if p.RebalanceExecution == nil {
+		p.RebalanceExecution = new(RebalanceExecutionConfig)
+	}
+
+	var c = p.RebalanceExecution
+	c.Mode = strings.ToLower(c.Mode)
+	if c.Mode == "" {
+		c.Mode = ExecutionDirect
+	}
+
+	if c.MaxReprices == 0 {
+		c.MaxReprices = 3
+	}
+
+	if c.MaxReprices < 0 {
+		errs.add("rebalance_execution 的max_reprices 不能小于0")
+	}
+
+	switch c.Mode {
+	case ExecutionDirect:
+	case ExecutionTWAP:
+		if c.Slices < 2 {
+			errs.add("rebalance_execution 使用twap时slices 子订单数量必须大于1")
+		} else if c.Duration/int64(c.Slices) < MinExecutionInterval {
+			errs.add("rebalance_execution 使用twap时duration/slices 不能小于%d毫秒", MinExecutionInterval)
+		}
+	case ExecutionIceberg:
+		if c.SliceAmount <= 0 {
+			errs.add("rebalance_execution 使用iceberg时slice_amount 每次挂出的数量必须大于0")
+		}
+		if c.RepriceInterval < MinExecutionInterval {
+			errs.add("rebalance_execution 使用iceberg时reprice_interval 不能小于%d毫秒", MinExecutionInterval)
+		}
+	default:
+		errs.add("rebalance_execution 的mode must be %s/%s/%s", ExecutionDirect, ExecutionTWAP, ExecutionIceberg)
+	}
+}
+
+const (
+	CancelPriorityAge      = "age"      // 先取消创建时间最早的订单
+	CancelPriorityDistance = "distance" // 先取消价格离买一卖一价最远的订单
+)
+
+// 取消超时订单的策略
+type CancelPolicyConfig struct {
+	OwnedOnly        bool     `yaml:"owned_only"`
+	Priority         string   `yaml:"priority"`
+	BatchThreshold   int      `yaml:"batch_threshold"`
+	MaxFilledPercent float64  `yaml:"max_filled_percent"`
+	MatchSignature   bool     `yaml:"match_signature"`
+	AllowIds         []string `yaml:"allow_ids"`
+	DenyIds          []string `yaml:"deny_ids"`
+	DenyAmounts      []string `yaml:"deny_amounts"`
+}
+
+// 检查撤单策略配置，未配置时按创建时间取消所有超时订单
+func (p *Configuration) checkCancelPolicy(errs *ConfigErrors) {
+	if p.CancelPolicy == nil {
+		p.CancelPolicy = new(CancelPolicyConfig)
+	}
+
+	var c = p.CancelPolicy
+	c.Priority = strings.ToLower(c.Priority)
+	if c.Priority == "" {
+		c.Priority = CancelPriorityAge
+	}
+
+	if c.Priority != CancelPriorityAge && c.Priority != CancelPriorityDistance {
+		errs.add("cancel_policy 的priority must be %s/%s", CancelPriorityAge, CancelPriorityDistance)
+	}
+
+	if c.BatchThreshold < 0 {
+		errs.add("cancel_policy 的batch_threshold 不能小于0")
+	}
+
+	if c.MaxFilledPercent < 0 || c.MaxFilledPercent > 100 {
+		errs.add("cancel_policy 的max_filled_percent 必须大于等于0,同时小于等于100")
+	}
+
+	for _, id := range c.DenyIds {
+		for _, allow := range c.AllowIds {
+			if id == allow {
+				errs.add("cancel_policy 的订单 %s 不能同时在allow_ids和deny_ids中", id)
+			}
+		}
+	}
+
+	for _, amount := range c.DenyAmounts {
+		if v, err := strconv.ParseFloat(amount, 64); err != nil || v <= 0 {
+			errs.add("cancel_policy 的deny_amounts 中的数量 %q 无效", amount)
+		}
+	}
+}
+
+const (
+	FeeAssetReceived = "received" // 使用收到的资产支付手续费，买入时为base，卖出时为quote
+	FeeAssetQuote    = "quote"    // 使用quote支付手续费
+	FeeAssetOne      = "one"      // 使用ONE支付手续费，可以享受one_discount折扣
+)
+
+// 手续费模型，挂单成交使用maker_rate，吃单成交使用taker_rate
+type FeeModelConfig struct {
+	MakerRate   float64 `yaml:"maker_rate"`
+	TakerRate   float64 `yaml:"taker_rate"`
+	FeeAsset    string  `yaml:"fee_asset"`
+	OneDiscount float64 `yaml:"one_discount"`
+}
+
+// 实际手续费率，使用ONE支付时扣除折扣
+func (p *FeeModelConfig) Rate(maker bool) float64 {
+	var rate = p.TakerRate
+	if maker {
+		rate = p.MakerRate
+	}
+
+	if p.FeeAsset == FeeAssetOne {
+		rate *= 1 - p.OneDiscount/100
+	}
+	return rate
+}
+
+// 检查手续费模型配置
+func checkFeeModel(name string, c *FeeModelConfig, errs *ConfigErrors) {
+	c.FeeAsset = strings.ToLower(c.FeeAsset)
+	if c.FeeAsset == "" {
+		c.FeeAsset = FeeAssetReceived
+	}
+
+	if c.FeeAsset != FeeAssetReceived && c.FeeAsset != FeeAssetQuote && c.FeeAsset != FeeAssetOne {
+		errs.add("%s 的fee_asset must be %s/%s/%s", name, FeeAssetReceived, FeeAssetQuote, FeeAssetOne)
+	}
+
+	if c.MakerRate < 0 || c.MakerRate >= 1 || c.TakerRate < 0 || c.TakerRate >= 1 {
+		errs.add("%s 的maker_rate和taker_rate 手续费率必须大于等于0,同时小于1", name)
+	}
+
+	if c.OneDiscount < 0 || c.OneDiscount >= 100 {
+		errs.add("%s 的one_discount 必须大于等于0,同时小于100", name)
+	}
+}
+
+// 盈亏统计，每天结束时将当天的盈亏追加写入report_file
+type PnlConfig struct {
+	Enable     bool   `yaml:"enable"`
+	ReportFile string `yaml:"report_file"`
+}
+
+// 是否开启盈亏统计
+func (p *Configuration) PnlEnabled() bool {
+	return p.Pnl != nil && p.Pnl.Enable
 }
 
+// 检查盈亏统计配置，挖矿收益使用挖矿限量检查的收益估算，需要设置one_price_market
+func (p *Configuration) checkPnl(errs *ConfigErrors) {
+	if !p.PnlEnabled() {
+		return
+	}
+
+	if p.Pnl.ReportFile == "" {
+		p.Pnl.ReportFile = "data/pnl.jsonl"
+	}
+
+	if p.EnableCheckLimitation && p.OnePriceMarket == "" {
+		errs.add("pnl 统计挖矿收益时one_price_market 用于计算ONE价格的交易对必须设置")
+	}
+}
+
+const (
+	HTTPAuthNone  = ""
+	HTTPAuthBasic = "basic"
+	HTTPAuthToken = "token"
+
+	DefaultHTTPListen = "0.0.0.0:18080"
+)
+
+// 状态接口http服务配置
+type HTTPConfig struct {
+	Disable     bool   `yaml:"disable"`
+	Listen      string `yaml:"listen"`
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	Auth        string `yaml:"auth"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	Token       string `yaml:"token"`
+}
+
+// 检查http服务配置，未配置时使用默认监听地址且不认证
+func (p *Configuration) checkHTTP(errs *ConfigErrors) {
+	if p.HTTP == nil {
+		p.HTTP = new(HTTPConfig)
+	}
+
+	if p.HTTP.Disable {
+		return
+	}
+
+	if p.HTTP.Listen == "" {
+		p.HTTP.Listen = DefaultHTTPListen
+	}
+
+	if (p.HTTP.TLSCertFile == "") != (p.HTTP.TLSKeyFile == "") {
+		errs.add("http_server 的tls_cert_file和tls_key_file必须同时设置")
+	}
+
+	p.HTTP.Auth = strings.ToLower(p.HTTP.Auth)
+	switch p.HTTP.Auth {
+	case HTTPAuthNone:
+	case HTTPAuthBasic:
+		if p.HTTP.Username == "" || p.HTTP.Password == "" {
+			errs.add("http_server 使用basic认证时username和password必须设置")
+		}
+	case HTTPAuthToken:
+		if p.HTTP.Token == "" {
+			errs.add("http_server 使用token认证时token必须设置")
+		}
+	default:
+		errs.add("http_server 的auth must be %s/%s or empty", HTTPAuthBasic, HTTPAuthToken)
+	}
+}
+
+// 跨账户对敲配置，买单和卖单分别由两个账户下单
+type CrossConfig struct {
+	Enable             bool    `yaml:"enable"`
+	BidAccount         string  `yaml:"bid_account"`
+	AskAccount         string  `yaml:"ask_account"`
+	SymbolPair         string  `yaml:"symbol_pair"`
+	ExchangeAmount     float64 `yaml:"exchange_amount"`
+	ExchangeInterval   int64   `yaml:"exchange_interval"`
+	RebalanceInterval  int64   `yaml:"rebalance_interval"`
+	RebalanceThreshold float64 `yaml:"rebalance_threshold"`
+}
+
+// 检查跨账户对敲配置
+func (p *Configuration) checkCross(errs *ConfigErrors) {
+	if p.Cross == nil || !p.Cross.Enable {
+		return
+	}
+
+	var names = make(map[string]bool)
+	for _, a := range p.Accounts {
+		names[a.Name] = true
+	}
+
+	if !names[p.Cross.BidAccount] || !names[p.Cross.AskAccount] {
+		errs.add("cross_exchange 的bid_account和ask_account必须是accounts中的账户")
+	}
+
+	if p.Cross.BidAccount == p.Cross.AskAccount {
+		errs.add("cross_exchange 的bid_account和ask_account不能是同一个账户")
+	}
+
+	if p.Cross.SymbolPair == "" {
+		errs.add("cross_exchange 的symbol_pair 交易对必须设置")
+	}
+	p.Cross.SymbolPair = strings.ToUpper(p.Cross.SymbolPair)
+
+	if p.Cross.ExchangeAmount <= 0 {
+		errs.add("cross_exchange 的exchange_amount 交易数量必须大于0")
+	}
+
+	if p.Cross.ExchangeInterval < 1000 || p.Cross.RebalanceInterval < 1000 {
+		errs.add("cross_exchange 的exchange_interval和rebalance_interval不能小于1000毫秒")
+	}
+
+	if p.Cross.RebalanceThreshold < 0 {
+		errs.add("cross_exchange 的rebalance_threshold 不能小于0")
+	}
+}
+
+// 账户配置，每个账户使用单独的api凭证和交易市场，
+// 未设置symbol_pair和markets时使用全局配置
+type AccountConfig struct {
+	Name       string          `yaml:"name"`
+	AppKey     string          `yaml:"appkey"`
+	AppSecret  string          `yaml:"appsecret"`
+	SymbolPair string          `yaml:"symbol_pair"`
+	Markets    []*MarketConfig `yaml:"markets"`
+}
+
+// 生成每个账户的配置，未配置accounts时只使用全局配置的账户
+func (p *Configuration) AccountConfigs() []*Configuration {
+	if len(p.Accounts) == 0 {
+		return []*Configuration{p}
+	}
+
+	var cfgs = make([]*Configuration, 0, len(p.Accounts))
+	for _, a := range p.Accounts {
+		var c = *p
+		c.Accounts = nil
+		c.Account = a.Name
+		c.AppKey = a.AppKey
+		c.AppSecret = a.AppSecret
+
+		if a.SymbolPair != "" {
+			c.SymbolPair = a.SymbolPair
+		}
+
+		if len(a.Markets) != 0 {
+			c.Markets = a.Markets
+		}
+
+		// 每个账户使用单独的挖矿份额记录文件
+		if c.ShareHistoryFile != "" {
+			ext := filepath.Ext(c.ShareHistoryFile)
+			c.ShareHistoryFile = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(c.ShareHistoryFile, ext), c.Account, ext)
+		}
+
+		// 每个账户使用单独的机器人订单记录文件
+		if c.OwnedOrdersFile != "" {
+			ext := filepath.Ext(c.OwnedOrdersFile)
+			c.OwnedOrdersFile = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(c.OwnedOrdersFile, ext), c.Account, ext)
+		}
+
+		// 每个账户使用单独的盈亏报告文件
+		if c.Pnl != nil && c.Pnl.ReportFile != "" {
+			var pnl = *c.Pnl
+			ext := filepath.Ext(pnl.ReportFile)
+			pnl.ReportFile = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(pnl.ReportFile, ext), c.Account, ext)
+			c.Pnl = &pnl
+		}
+
+		cfgs = append(cfgs, &c)
+	}
+
+	return cfgs
+}
+
+// 检查交易市场配置
+func checkMarkets(name string, markets []*MarketConfig, errs *ConfigErrors) {
+	var pairs = make(map[string]bool)
+	for _, m := range markets {
+		if m.SymbolPair == "" {
+			errs.add("%s 中的symbol_pair 交易对必须设置", name)
+			continue
+		}
+
+		pair := strings.ToUpper(m.SymbolPair)
+		if pairs[pair] {
+			errs.add("%s 中的交易对 %s 重复", name, pair)
+			continue
+		}
+		pairs[pair] = true
+
+		if m.ExchangeAmount < 0 || m.ExchangeInterval < 0 {
+			errs.add("%s 中交易对 %s 的exchange_amount和exchange_interval不能小于0", name, pair)
+		}
+
+		if m.BalancePercent < 0 || m.BalancePercent > 100 ||
+			m.BalanceExchangePercent < 0 || m.BalanceExchangePercent > 100 {
+			errs.add("%s 中交易对 %s 的balance_percent和balance_exchange_percent必须大于等于0,同时小于等于100", name, pair)
+		}
+
+		if m.FeeModel != nil {
+			checkFeeModel(fmt.Sprintf("%s 中交易对 %s 的fee_model", name, pair), m.FeeModel, errs)
+		}
+	}
+}
+
+// 检查账户配置
+func (p *Configuration) checkAccounts(errs *ConfigErrors) {
+	var names = make(map[string]bool)
+	for _, a := range p.Accounts {
+		if a.Name == "" {
+			errs.add("accounts 中的name 账户名称必须设置")
+			continue
+		}
+
+		if names[a.Name] {
+			errs.add("accounts 中的账户 %s 重复", a.Name)
+			continue
+		}
+		names[a.Name] = true
+
+		if a.AppKey == "" || a.AppSecret == "" {
+			errs.add("accounts 中账户 %s 的appkey和appsecret必须设置", a.Name)
+		}
+
+		if a.SymbolPair == "" && len(a.Markets) == 0 && p.SymbolPair == "" && len(p.Markets) == 0 {
+			errs.add("accounts 中账户 %s 的交易对必须设置", a.Name)
+		}
+
+		checkMarkets(fmt.Sprintf("accounts 中账户 %s 的markets", a.Name), a.Markets, errs)
+	}
+}
+
+// 交易市场配置，未设置(为0或空)的字段使用全局配置
+type MarketConfig struct {
+	SymbolPair             string  `yaml:"symbol_pair"`
+	ExchangeAmount         float64 `yaml:"exchange_amount"`
+	ExchangeInterval       int64   `yaml:"exchange_interval"`
+	ExpectDiffrentValue    float64 `yaml:"expect_diffrent_value"`
+	BalanceAccountBalance  *bool   `yaml:"balance_account_balance"`
+	BalancePercent         int     `yaml:"balance_percent"`
+	BalanceExchange        *bool   `yaml:"balance_exchange"`
+	BalanceExchangePercent int     `yaml:"balance_exchange_percent"`
+	BtcPriceMarket         string  `yaml:"btc_price_market"`
+
+	// 替换全局的fee_model
+	FeeModel *FeeModelConfig `yaml:"fee_model"`
+}
+
+// 生成每个交易市场的配置，未配置markets时只使用全局配置的交易对
+func (p *Configuration) MarketConfigs() []*Configuration {
+	if len(p.Markets) == 0 {
+		return []*Configuration{p}
+	}
+
+	var cfgs = make([]*Configuration, 0, len(p.Markets))
+	for _, m := range p.Markets {
+		var c = *p
+		c.Markets = nil
+		c.SymbolPair = strings.ToUpper(m.SymbolPair)
+
+		if m.ExchangeAmount != 0 {
+			c.ExchangeAmount = m.ExchangeAmount
+		}
+
+		if m.ExchangeInterval != 0 {
+			c.ExchangeInterval = m.ExchangeInterval
+		}
+
+		if m.ExpectDiffrentValue != 0 {
+			c.ExpectDiffrentValue = m.ExpectDiffrentValue
+		}
+
+		if m.BalanceAccountBalance != nil {
+			c.BalanceAccountBalance = *m.BalanceAccountBalance
+		}
+
+		if m.BalancePercent != 0 {
+			c.BalancePercent = m.BalancePercent
+		}
+
+		if m.BalanceExchange != nil {
+			c.BalanceExchange = *m.BalanceExchange
+		}
+
+		if m.BalanceExchangePercent != 0 {
+			c.BalanceExchangePercent = m.BalanceExchangePercent
+		}
+
+		if m.BtcPriceMarket != "" {
+			c.BtcPriceMarket = m.BtcPriceMarket
+		}
+
+		if m.FeeModel != nil {
+			c.FeeModel = m.FeeModel
+		}
+
+		// 每个市场使用单独的盈亏报告文件
+		if c.Pnl != nil && c.Pnl.ReportFile != "" {
+			var pnl = *c.Pnl
+			ext := filepath.Ext(pnl.ReportFile)
+			pnl.ReportFile = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(pnl.ReportFile, ext), c.SymbolPair, ext)
+			c.Pnl = &pnl
+		}
+
+		cfgs = append(cfgs, &c)
+	}
+
+	return cfgs
+}
+
+// 输出配置时密钥替换为该值
+const RedactedValue = "******"
+
+// 配置中所有非空的密钥，用于从日志中隐藏
+func (p *Configuration) Secrets() []string {
+	var values = []string{p.AppKey, p.AppSecret, p.ControlToken}
+	for _, a := range p.Accounts {
+		values = append(values, a.AppKey, a.AppSecret)
+	}
+	if p.HTTP != nil {
+		values = append(values, p.HTTP.Password, p.HTTP.Token)
+	}
+
+	var secrets []string
+	for _, v := range values {
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+// 返回隐藏密钥后的配置拷贝，用于输出配置
+func (p *Configuration) Redacted() *Configuration {
+	var c = *p
+	redact(&c.AppKey)
+	redact(&c.AppSecret)
+	redact(&c.ControlToken)
+
+	if p.Accounts != nil {
+		c.Accounts = make([]*AccountConfig, 0, len(p.Accounts))
+		for _, a := range p.Accounts {
+			var ac = *a
+			redact(&ac.AppKey)
+			redact(&ac.AppSecret)
+			c.Accounts = append(c.Accounts, &ac)
+		}
+	}
+
+	if p.HTTP != nil {
+		var hc = *p.HTTP
+		redact(&hc.Password)
+		redact(&hc.Token)
+		c.HTTP = &hc
+	}
+
+	return &c
+}
+
+func redact(s *string) {
+	if *s != "" {
+		*s = RedactedValue
+	}
+}
+
+// 运行时可以直接修改的配置项，其他配置项修改后需要重启
+// exchange_interval等定时任务间隔和执行方式修改后重新调度已加入调度器的任务
+var reloadableKeys = map[string]bool{
+	"exchange_interval":                true,
+	"check_order_interval":             true,
+	"check_limitation_interval":        true,
+	"schedule_modes":                   true,
+	"one_hourly_limitation_percent":    true,
+	"exchange_amount":                  true,
+	"balance_account_balance":          true,
+	"balance_percent":                  true,
+	"balance_exchange":                 true,
+	"balance_exchange_percent":         true,
+	"expect_diffrent_value":            true,
+	"check_order_number":               true,
+	"cancel_order_diffrent_time":       true,
+	"check_order_type":                 true,
+	"cancel_order_interval":            true,
+	"cancel_order_lock_exchange":       true,
+	"check_balance_relay_time":         true,
+	"create_exchange_client_wait_time": true,
+	"balance_lock_cancel_order":        true,
+	"volume_target":                    true,
+	"volume_target_unit":               true,
+	"volume_min_interval":              true,
+	"volume_max_interval":              true,
+	"profit_stop_enable":               true,
+	"profit_min_reward_ratio":          true,
+	"trading_time":                     true,
+	"risk":                             true,
+	"price_guard":                      true,
+	"rebalance_target":                 true,
+	"rebalance_execution":              true,
+	"cancel_policy":                    true,
+	"fee_model":                        true,
+	"predictive_stop_enable":           true,
+	"predictive_stop_factor":           true,
+	"fee_rate":                         true,
+	"one_price_market":                 true,
+	"btc_price_market":                 true,
+}
+
+// 不输出修改前后值的配置项
+var secretKeys = map[string]bool{
+	"appkey":        true,
+	"appsecret":     true,
+	"control_token": true,
+	"http_server":   true,
+}
+
+// 配置修改项，Scope为 账户/交易对
+type ConfigChange struct {
+	Key   string      `json:"key"`
+	Scope string      `json:"scope"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+func (p *ConfigChange) String() string {
+	if p.Old == nil && p.New == nil {
+		return fmt.Sprintf("%s[%s]", p.Key, p.Scope)
+	}
+	return fmt.Sprintf("%s[%s]: %v -> %v", p.Key, p.Scope, p.Old, p.New)
+}
+
+// 按 账户/交易对 展开每个交易市场的配置
+func (p *Configuration) ScopedConfigs() map[string]*Configuration {
+	var cfgs = make(map[string]*Configuration)
+	for _, a := range p.AccountConfigs() {
+		for _, m := range a.MarketConfigs() {
+			cfgs[m.Scope()] = m
+		}
+	}
+	return cfgs
+}
+
+// 交易市场配置的范围，格式为 账户/交易对
+func (p *Configuration) Scope() string {
+	return fmt.Sprintf("%s/%s", p.Account, strings.ToUpper(p.SymbolPair))
+}
+
+func sortedScopes(cfgs map[string]*Configuration) []string {
+	var scopes = make([]string, 0, len(cfgs))
+	for scope := range cfgs {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// 比较运行中的配置和新配置，返回可以直接应用的修改和需要重启才能生效的修改
+func (p *Configuration) Diff(n *Configuration) (changes, restart []*ConfigChange) {
+	if !reflect.DeepEqual(p.Cross, n.Cross) {
+		restart = append(restart, &ConfigChange{Key: "cross_exchange"})
+	}
+
+	var (
+		olds = p.ScopedConfigs()
+		news = n.ScopedConfigs()
+	)
+
+	for _, scope := range sortedScopes(olds) {
+		if _, ok := news[scope]; !ok {
+			restart = append(restart, &ConfigChange{Key: "markets", Scope: scope})
+		}
+	}
+
+	for _, scope := range sortedScopes(news) {
+		nc := news[scope]
+		oc, ok := olds[scope]
+		if !ok {
+			restart = append(restart, &ConfigChange{Key: "markets", Scope: scope})
+			continue
+		}
+
+		ov := reflect.ValueOf(oc).Elem()
+		nv := reflect.ValueOf(nc).Elem()
+		for i := 0; i < ov.NumField(); i++ {
+			key := ov.Type().Field(i).Tag.Get("yaml")
+			switch key {
+			case "", "-", "markets", "accounts", "cross_exchange":
+				continue
+			}
+
+			o, v := ov.Field(i).Interface(), nv.Field(i).Interface()
+			if reflect.DeepEqual(o, v) {
+				continue
+			}
+
+			var c = &ConfigChange{Key: key, Scope: scope, Old: o, New: v}
+			if secretKeys[key] {
+				c.Old, c.New = nil, nil
+			}
+
+			if reloadableKeys[key] {
+				changes = append(changes, c)
+			} else {
+				restart = append(restart, c)
+			}
+		}
+	}
+
+	return changes, restart
+}
+
+// 定时任务的最小间隔，单位毫秒
+const MinScheduleInterval = 100
+
+// 配置检查错误，包含所有检查不通过的配置项
+type ConfigErrors []error
+
+func (p ConfigErrors) Error() string {
+	var lines = make([]string, 0, len(p))
+	for _, err := range p {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return fmt.Sprintf("配置检查发现%d个问题:\n%s", len(p), strings.Join(lines, "\n"))
+}
+
+func (p *ConfigErrors) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Errorf(format, args...))
+}
+
+// 没有错误时返回nil
+func (p ConfigErrors) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// 检查时间相关配置以及配置之间的一致性
+func (p *Configuration) checkTiming(errs *ConfigErrors) {
+	if p.RequestTimeout <= 0 {
+		errs.add("request_timeout 请求超时时间必须大于0")
+	}
+
+	if p.CheckBalanceRelayTime < 0 {
+		errs.add("check_balance_relay_time 检查资产延时不能小于0")
+	}
+
+	if p.CancelOrderInterval < 0 {
+		errs.add("cancel_order_interval 取消订单时间间隔不能小于0")
+	}
+
+	if p.CancelOrderDiffrentTime < 0 {
+		errs.add("cancel_order_diffrent_time 订单超时时间不能小于0")
+	}
+
+	// 定时任务间隔过小时会频繁调用交易所接口
+	type interval struct {
+		name  string
+		value int64
+	}
+
+	var intervals = []interval{
+		{"check_limitation_interval", p.CheckLimitationInterval},
+		{"exchange_interval", p.ExchangeInterval},
+		{"check_order_interval", p.CheckOrderInterval},
+	}
+	for _, a := range p.AccountConfigs() {
+		for _, m := range a.MarketConfigs() {
+			if m.ExchangeInterval != p.ExchangeInterval {
+				intervals = append(intervals, interval{m.Scope() + " 的exchange_interval", m.ExchangeInterval})
+			}
+		}
+	}
+	if p.Cross != nil && p.Cross.Enable {
+		intervals = append(intervals,
+			interval{"cross_exchange 的exchange_interval", p.Cross.ExchangeInterval},
+			interval{"cross_exchange 的rebalance_interval", p.Cross.RebalanceInterval})
+	}
+	for _, i := range intervals {
+		if i.value > 0 && i.value < MinScheduleInterval {
+			errs.add("%s 为%d毫秒, 不能小于%d毫秒", i.name, i.value, MinScheduleInterval)
+		}
+	}
+
+	p.checkScheduleModes(errs)
+
+	// 一次撤单检查最多逐个取消check_order_number个订单，耗时不能超过检查间隔，否则撤单检查会堆积
+	if p.CheckOrderInterval > 0 && int64(p.CheckOrderNumber)*p.CancelOrderInterval >= p.CheckOrderInterval {
+		errs.add("check_order_number*cancel_order_interval(%d毫秒) 必须小于check_order_interval(%d毫秒)",
+			int64(p.CheckOrderNumber)*p.CancelOrderInterval, p.CheckOrderInterval)
+	}
+
+	// 订单超时时间小于交易间隔时，本次交易的订单在下一次交易前就会被当作超时订单取消
+	if !p.VolumeTargetEnable && p.CancelOrderDiffrentTime > 0 && p.CancelOrderDiffrentTime < p.ExchangeInterval {
+		errs.add("cancel_order_diffrent_time(%d毫秒) 不能小于exchange_interval(%d毫秒)",
+			p.CancelOrderDiffrentTime, p.ExchangeInterval)
+	}
+
+	if p.VolumeTargetEnable && p.CancelOrderDiffrentTime > 0 && p.CancelOrderDiffrentTime < p.VolumeMinInterval {
+		errs.add("cancel_order_diffrent_time(%d毫秒) 不能小于volume_min_interval(%d毫秒)",
+			p.CancelOrderDiffrentTime, p.VolumeMinInterval)
+	}
+}
+
+// 检查配置并设置默认值，返回所有检查不通过的配置项
 func (p *Configuration) Check() error {
+	var errs ConfigErrors
+
 	if p.EndPoint == "" {
-		return fmt.Errorf("endpoint必须设置")
+		errs.add("endpoint必须设置")
 	}
 
-	if p.AppKey == "" {
-		return fmt.Errorf("appkey必须设置")
+	if len(p.Accounts) == 0 {
+		if p.AppKey == "" {
+			errs.add("appkey必须设置")
+		}
+
+		if p.AppSecret == "" {
+			errs.add("appsecret必须设置")
+		}
+
+		if p.SymbolPair == "" && len(p.Markets) == 0 {
+			errs.add("symbol 交易対必须设置")
+		}
+
+		if p.Account == "" {
+			p.Account = DefaultAccountName
+		}
 	}
 
-	if p.AppSecret == "" {
-		return fmt.Errorf("appsecret必须设置")
+	p.checkAccounts(&errs)
+	checkMarkets("markets", p.Markets, &errs)
+	p.checkCross(&errs)
+	p.checkHTTP(&errs)
+	p.checkTradingTime(&errs)
+	p.checkRisk(&errs)
+	p.checkPriceGuard(&errs)
+	p.checkCircuitBreaker(&errs)
+	p.checkRebalanceTarget(&errs)
+	p.checkRebalanceExecution(&errs)
+	p.checkCancelPolicy(&errs)
+	p.checkPnl(&errs)
+
+	if p.FeeModel == nil {
+		p.FeeModel = &FeeModelConfig{MakerRate: p.FeeRate, TakerRate: p.FeeRate}
 	}
+	checkFeeModel("fee_model", p.FeeModel, &errs)
 
-	if p.SymbolPair == "" {
-		return fmt.Errorf("symbol 交易対必须设置")
+	if p.ConfigWatchInterval < 0 {
+		errs.add("config_watch_interval 检查配置文件修改间隔不能小于0")
+	}
+
+	if p.RequestRateLimit < 0 {
+		errs.add("request_rate_limit 每秒请求数不能小于0")
 	}
 
 	if p.OneHourlyLimitationPercent <= 0 || p.OneHourlyLimitationPercent > 100 {
-		return fmt.Errorf("每小时挖矿限量百分比必须大于0,同时小于等于100")
+		errs.add("每小时挖矿限量百分比必须大于0,同时小于等于100")
 	}
 
 	if p.CheckLimitationInterval == 0 {
-		return fmt.Errorf("检查每小时挖矿限量时间间隔不能为0")
+		errs.add("检查每小时挖矿限量时间间隔不能为0")
 	}
 
 	if p.ExchangeAmount == 0 {
-		return fmt.Errorf("sellnumber 不能为0或者未设置")
+		errs.add("sellnumber 不能为0或者未设置")
 	}
 
 	if p.BalancePercent <= 0 || p.BalancePercent > 100 {
-		return fmt.Errorf("balance_percent 资产平衡时交易数量占exchange_amount百分比必须大于0小于等于100")
+		errs.add("balance_percent 资产平衡时交易数量占exchange_amount百分比必须大于0小于等于100")
 	}
 
 	if p.BalanceExchangePercent <= 0 || p.BalanceExchangePercent > 100 {
-		return fmt.Errorf("balance_percent 资产不足时交易数量占exchange_amount百分比必须大于0小于等于100")
+		errs.add("balance_percent 资产不足时交易数量占exchange_amount百分比必须大于0小于等于100")
 	}
 
 	//	if p.ExpectDiffrentValue == 0 {
@@ -83,23 +1315,21 @@ func (p *Configuration) Check() error {
 	//	}
 
 	if p.CancelOrderDiffrentTime == 0 {
-		return fmt.Errorf("cancel_order_diffrent_time 订单创建时间与交易所服务器时间差不能等于0或则未设置")
+		errs.add("cancel_order_diffrent_time 订单创建时间与交易所服务器时间差不能等于0或则未设置")
 	}
 
 	if p.ExchangeInterval == 0 {
-		return fmt.Errorf("exchange_interval 自动交易频率不能为0或者未设置")
+		errs.add("exchange_interval 自动交易频率不能为0或者未设置")
 	}
 
 	if p.CheckOrderNumber == 0 {
-		return fmt.Errorf("check_order_number 订单列表数量不能为0或者未设置")
+		errs.add("check_order_number 订单列表数量不能为0或者未设置")
 	}
 
 	if p.CancelOrderTypes == nil {
-		return fmt.Errorf("cancel_order_type 必须设置")
-	}
-
-	if len(p.CancelOrderTypes) == 0 {
-		return fmt.Errorf("order_type 不能为空")
+		errs.add("cancel_order_type 必须设置")
+	} else if len(p.CancelOrderTypes) == 0 {
+		errs.add("order_type 不能为空")
 	}
 
 	for _, v := range p.CancelOrderTypes {
@@ -107,12 +1337,82 @@ func (p *Configuration) Check() error {
 		case OrderCanceledState, OrderFilledState, OrderPendingState:
 			break
 		default:
-			return fmt.Errorf("cancel_order_type must be %s/%s/%s",
+			errs.add("cancel_order_type must be %s/%s/%s",
 				OrderCanceledState, OrderPendingState, OrderFilledState)
 			break
 		}
 	}
 
+	if p.VolumeTargetEnable {
+		if p.VolumeTarget <= 0 {
+			errs.add("volume_target 目标成交量必须大于0")
+		}
+
+		p.VolumeTargetUnit = strings.ToUpper(p.VolumeTargetUnit)
+		if p.VolumeTargetUnit != VolumeUnitBase && p.VolumeTargetUnit != VolumeUnitQuote {
+			errs.add("volume_target_unit must be %s/%s", VolumeUnitBase, VolumeUnitQuote)
+		}
+
+		p.VolumeTargetPeriod = strings.ToUpper(p.VolumeTargetPeriod)
+		if p.VolumeTargetPeriod != VolumePeriodHour && p.VolumeTargetPeriod != VolumePeriodDay {
+			errs.add("volume_target_period must be %s/%s", VolumePeriodHour, VolumePeriodDay)
+		}
+
+		if p.VolumeMinInterval <= 0 {
+			errs.add("volume_min_interval 最小交易间隔必须大于0")
+		}
+
+		if p.VolumeMaxInterval < p.VolumeMinInterval {
+			errs.add("volume_max_interval 最大交易间隔不能小于volume_min_interval")
+		}
+	}
+
+	if p.ProfitStopEnable {
+		if !p.EnableCheckLimitation {
+			errs.add("profit_stop_enable 需要开启enable_check_limitation")
+		}
+
+		if p.ProfitMinRewardRatio <= 0 {
+			errs.add("profit_min_reward_ratio 最低挖矿收益与手续费比值必须大于0")
+		}
+
+		if p.OnePriceMarket == "" {
+			errs.add("one_price_market 用于计算ONE价格的交易对必须设置")
+		}
+	}
+
+	if p.ShareTrackEnable {
+		if !p.EnableCheckLimitation {
+			errs.add("share_track_enable 需要开启enable_check_limitation")
+		}
+
+		if p.OnePriceMarket == "" {
+			errs.add("one_price_market 用于计算ONE价格的交易对必须设置")
+		}
+
+		if p.ShareHistoryFile == "" {
+			p.ShareHistoryFile = "data/share.jsonl"
+		}
+	}
+
+	if p.PredictiveStopEnable {
+		if !p.EnableCheckLimitation {
+			errs.add("predictive_stop_enable 需要开启enable_check_limitation")
+		}
+
+		if p.PredictiveStopFactor == 0 {
+			p.PredictiveStopFactor = 1
+		}
+
+		if p.PredictiveStopFactor < 0 {
+			errs.add("predictive_stop_factor 预测系数不能小于0")
+		}
+	}
+
+	if p.FeeRate < 0 || p.FeeRate >= 1 {
+		errs.add("fee_rate 手续费率必须大于等于0,同时小于1")
+	}
+
 	if p.CreateExchangeClientWaitTime == 0 {
 		p.CreateExchangeClientWaitTime = 2000
 	}
@@ -121,11 +1421,23 @@ func (p *Configuration) Check() error {
 		p.LogFile = "log/b1.log"
 	}
 
+	if p.AuditLogFile == "" {
+		p.AuditLogFile = "log/audit.log"
+	}
+
 	if p.LogLevel == "" {
 		p.LogLevel = "error"
 	}
 
-	return nil
+	switch strings.ToUpper(p.LogLevel) {
+	case "DEBUG", "INFO", "WARNNING", "WARNING", "ERROR":
+	default:
+		errs.add("log_level must be debug/info/warning/error")
+	}
+
+	p.checkTiming(&errs)
+
+	return errs.err()
 }
 
 type AccountResponeBody struct {
@@ -318,6 +1630,12 @@ type OrderResponeBody struct {
 	Errors []*ErrorMessage `json:"errors`
 }
 
+// 批量取消订单的响应，只关心是否返回了错误
+type CancelAllOrdersResponeBody struct {
+	Data   interface{}     `json:"data"`
+	Errors []*ErrorMessage `json:"errors"`
+}
+
 type ErrorMessage struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTradingTime(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		config *TradingTimeConfig
+		errors []string
+	}{
+		{
+			name: "valid",
+			config: &TradingTimeConfig{
+				Timezone: "Asia/Shanghai",
+				Windows:  []string{"* 9-17 * * 1-5"},
+				Blackouts: []*BlackoutConfig{
+					{Start: "2021-03-03 12:00", End: "2021-03-03 13:00"},
+					{Cron: "0-29 4 * * 3"},
+				},
+			},
+		},
+		{
+			// 时区错误时仍然检查停止交易时间段
+			name: "unknown timezone",
+			config: &TradingTimeConfig{
+				Timezone: "Mars/Olympus",
+				Blackouts: []*BlackoutConfig{
+					{Start: "2021-03-03 12:00", End: "2021-03-03 13:00"},
+					{Start: "2021-03-03 12:00", End: "2021-03-03 11:00"},
+				},
+			},
+			errors: []string{"timezone Mars/Olympus", "blackout-2 的end必须晚于start"},
+		},
+		{
+			name: "invalid window and blackout",
+			config: &TradingTimeConfig{
+				Windows: []string{"* 25 * * *"},
+				Blackouts: []*BlackoutConfig{
+					{Start: "2021-03-03", End: "2021-03-03 13:00"},
+					{Name: "mixed", Cron: "* * * * *", End: "2021-03-03 13:00"},
+				},
+			},
+			errors: []string{"windows错误", "start格式", "mixed 不能同时设置"},
+		},
+	} {
+		var (
+			cfg  = &Configuration{TradingTime: c.config}
+			errs ConfigErrors
+		)
+		cfg.checkTradingTime(&errs)
+
+		if len(errs) != len(c.errors) {
+			t.Errorf("%s: 检查结果 %v, 应有%d个问题", c.name, errs, len(c.errors))
+			continue
+		}
+		for i, e := range c.errors {
+			if !strings.Contains(errs[i].Error(), e) {
+				t.Errorf("%s: 第%d个问题 %q 应包含 %q", c.name, i+1, errs[i], e)
+			}
+		}
+		if len(errs) == 0 && cfg.Calendar == nil {
+			t.Errorf("%s: 检查通过时应创建交易日历", c.name)
+		}
+	}
+}
+
+func TestCheckScheduleModes(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		modes  map[string]string
+		errors []string
+	}{
+		{
+			name:  "defaults",
+			modes: map[string]string{"exchange": "fixed_rate", "cancel_order": "fixed_delay", "cross_rebalance": "fixed_delay"},
+		},
+		{
+			name:   "unknown job and mode",
+			modes:  map[string]string{"unknown": "fixed_rate", "cancel_order": "cron"},
+			errors: []string{"任务 unknown 不存在", "任务 cancel_order 的"},
+		},
+		{
+			// 只发出执行信号的任务使用fixed_delay时和fixed_rate相同
+			name:   "signal only job with fixed_delay",
+			modes:  map[string]string{"cross_exchange": "fixed_delay"},
+			errors: []string{"任务 cross_exchange 只发出执行信号"},
+		},
+	} {
+		var (
+			cfg  = &Configuration{ScheduleModes: c.modes}
+			errs ConfigErrors
+		)
+		cfg.checkScheduleModes(&errs)
+
+		if len(errs) != len(c.errors) {
+			t.Errorf("%s: 检查结果 %v, 应有%d个问题", c.name, errs, len(c.errors))
+			continue
+		}
+		for _, e := range c.errors {
+			var found bool
+			for _, err := range errs {
+				found = found || strings.Contains(err.Error(), e)
+			}
+			if !found {
+				t.Errorf("%s: 检查结果 %v 中没有 %s", c.name, errs, e)
+			}
+		}
+	}
+}
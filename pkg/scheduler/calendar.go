@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// 时间段，Start和End为空时使用Cron匹配
+type Period struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+	Cron  *Cron
+}
+
+func (p *Period) contains(t time.Time) bool {
+	if p.Cron != nil {
+		return p.Cron.Match(t)
+	}
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+func (p *Period) String() string {
+	if p.Cron != nil {
+		return fmt.Sprintf("%s(%s)", p.Name, p.Cron)
+	}
+	return fmt.Sprintf("%s(%s ~ %s)", p.Name, p.Start.Format("2006-01-02 15:04"), p.End.Format("2006-01-02 15:04"))
+}
+
+// 交易日历，匹配任意一个交易时间窗口且不在停止交易时间段内时允许交易，
+// 未配置交易时间窗口时除停止交易时间段外都允许交易
+type Calendar struct {
+	location  *time.Location
+	windows   []*Cron
+	blackouts []*Period
+}
+
+func NewCalendar(location *time.Location, windows []*Cron, blackouts []*Period) *Calendar {
+	if location == nil {
+		location = time.Local
+	}
+
+	return &Calendar{
+		location:  location,
+		windows:   windows,
+		blackouts: blackouts,
+	}
+}
+
+// 判断t是否允许交易，不允许时返回原因
+func (p *Calendar) Allowed(t time.Time) (bool, string) {
+	t = t.In(p.location)
+
+	for _, b := range p.blackouts {
+		if b.contains(t) {
+			return false, fmt.Sprintf("处于停止交易时间段 %s", b)
+		}
+	}
+
+	if len(p.windows) == 0 {
+		return true, ""
+	}
+
+	for _, w := range p.windows {
+		if w.Match(t) {
+			return true, ""
+		}
+	}
+
+	return false, "不在交易时间窗口内"
+}
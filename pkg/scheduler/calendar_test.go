@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustCron(t *testing.T, expr string) *Cron {
+	t.Helper()
+	c, err := ParseCron(expr)
+	if err != nil {
+		t.Fatalf("ParseCron(%q) 返回错误. %s", expr, err)
+	}
+	return c
+}
+
+func TestCalendarAllowed(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	// 2021-03-03 是周三
+	day := time.Date(2021, 3, 3, 0, 0, 0, 0, loc)
+
+	cal := NewCalendar(loc,
+		[]*Cron{mustCron(t, "* 9-17 * * 1-5")},
+		[]*Period{
+			{Name: "升级", Start: day.Add(12 * time.Hour), End: day.Add(13 * time.Hour)},
+			{Name: "维护", Cron: mustCron(t, "0-29 16 * * 3")},
+		})
+
+	for _, c := range []struct {
+		t       time.Time
+		allowed bool
+	}{
+		{day.Add(9 * time.Hour), true},
+		{day.Add(8*time.Hour + 59*time.Minute), false},
+		{day.Add(18 * time.Hour), false},
+		// 停止交易时间段包含开始时间，不包含结束时间
+		{day.Add(12 * time.Hour), false},
+		{day.Add(13 * time.Hour), true},
+		{day.Add(16*time.Hour + 10*time.Minute), false},
+		{day.Add(16*time.Hour + 30*time.Minute), true},
+		// 周六不在交易时间窗口内
+		{day.AddDate(0, 0, 3).Add(10 * time.Hour), false},
+		// 按日历时区判断
+		{day.Add(10 * time.Hour).UTC(), true},
+	} {
+		allowed, reason := cal.Allowed(c.t)
+		if allowed != c.allowed {
+			t.Errorf("%s 允许交易为%v, 应为%v. %s", c.t, allowed, c.allowed, reason)
+		}
+		if !allowed && reason == "" {
+			t.Errorf("%s 不允许交易时没有返回原因", c.t)
+		}
+	}
+}
+
+func TestCalendarNoWindows(t *testing.T) {
+	cal := NewCalendar(nil, nil, []*Period{{Name: "维护", Cron: mustCron(t, "0 0 * * *")}})
+
+	now := time.Date(2021, 3, 3, 10, 0, 0, 0, time.Local)
+	if allowed, _ := cal.Allowed(now); !allowed {
+		t.Errorf("未配置交易时间窗口时应允许交易")
+	}
+	if allowed, _ := cal.Allowed(time.Date(2021, 3, 3, 0, 0, 0, 0, time.Local)); allowed {
+		t.Errorf("处于停止交易时间段时不应允许交易")
+	}
+}
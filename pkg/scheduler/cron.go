@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron表达式，格式为 分 时 日 月 周，精度为分钟
+// 每个字段支持 *、数字、范围a-b、步长*/n或a-b/n，以及逗号分隔的列表
+// 周的取值为0-6，0和7都表示周日
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// 解析cron表达式
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron表达式 %q 必须包含%d个字段", expr, len(cronFields))
+	}
+
+	var bits = make([]uint64, len(fields))
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron表达式 %q 的%s字段错误. %s", expr, cronFields[i].name, err)
+		}
+		bits[i] = b
+	}
+
+	// 7和0都表示周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		expr:   expr,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		var (
+			rng  = part
+			step = 1
+			err  error
+		)
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("步长 %q 错误", part[i+1:])
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("取值 %q 错误", bounds[0])
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("取值 %q 错误", bounds[1])
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("取值 %q 超出范围%d-%d", rng, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// 判断t所在的分钟是否匹配表达式，日和周都不为*时满足其中一个即可
+func (p *Cron) Match(t time.Time) bool {
+	if p.minute&(1<<uint(t.Minute())) == 0 ||
+		p.hour&(1<<uint(t.Hour())) == 0 ||
+		p.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := p.dom&(1<<uint(t.Day())) != 0
+	dow := p.dow&(1<<uint(t.Weekday())) != 0
+	if p.anyDom || p.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (p *Cron) String() string {
+	return p.expr
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *",
+		"0-29 4 * * 3",
+		"*/15 9-17 * * 1-5",
+		"0 0 1,15 * 7",
+		"5/10 * * 1-12/2 *",
+	} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) 返回错误. %s", expr, err)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2021-03-03 是周三
+	var day = time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		expr  string
+		t     time.Time
+		match bool
+	}{
+		{"* * * * *", day, true},
+		{"0-29 4 * * 3", day.Add(4*time.Hour + 29*time.Minute), true},
+		{"0-29 4 * * 3", day.Add(4*time.Hour + 30*time.Minute), false},
+		{"0-29 4 * * 3", day.Add(24*time.Hour + 4*time.Hour), false},
+		{"*/15 * * * *", day.Add(45 * time.Minute), true},
+		{"*/15 * * * *", day.Add(50 * time.Minute), false},
+		{"5/10 * * * *", day.Add(25 * time.Minute), true},
+		// 0和7都表示周日，2021-03-07 是周日
+		{"0 0 * * 7", day.AddDate(0, 0, 4), true},
+		{"0 0 * * 0", day.AddDate(0, 0, 4), true},
+		// 日和周都不为*时满足其中一个即可
+		{"0 0 1 * 3", day, true},
+		{"0 0 1 * 3", day.AddDate(0, 0, 1), false},
+		{"0 0 1 * *", day, false},
+	} {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) 返回错误. %s", c.expr, err)
+		}
+		if m := cron.Match(c.t); m != c.match {
+			t.Errorf("%q 匹配 %s 结果为%v, 应为%v", c.expr, c.t, m, c.match)
+		}
+	}
+}
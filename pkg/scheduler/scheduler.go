@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 定时任务
+type Job interface {
+	Run() error
+	Stop() error
+}
+
+// 任务执行方式
+type Mode int
+
+const (
+	// 按固定频率执行，每次执行时间为上一次计划时间加间隔，不受任务执行耗时影响，
+	// 执行落后超过一个间隔时跳过错过的执行，不会连续补执行
+	FixedRate Mode = iota
+	// 上一次执行结束后等待间隔再执行
+	FixedDelay
+)
+
+const (
+	FixedRateName  = "fixed_rate"
+	FixedDelayName = "fixed_delay"
+)
+
+func (m Mode) String() string {
+	if m == FixedDelay {
+		return FixedDelayName
+	}
+	return FixedRateName
+}
+
+// 解析任务执行方式，为空时使用FixedRate
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", FixedRateName:
+		return FixedRate, nil
+	case FixedDelayName:
+		return FixedDelay, nil
+	}
+	return FixedRate, fmt.Errorf("schedule mode must be %s/%s", FixedRateName, FixedDelayName)
+}
+
+// 毫秒精度的调度器，每个任务使用单独的goroutine执行
+type Scheduler struct {
+	sync.Mutex
+	entries map[*Entry]bool
+	started bool
+	onError func(job Job, err error)
+}
+
+// 已添加的任务
+type Entry struct {
+	job      Job
+	first    time.Time
+	base     time.Time
+	interval time.Duration
+	mode     Mode
+	once     bool
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// 运行中修改间隔和执行方式
+	mu    sync.Mutex
+	reset chan struct{}
+}
+
+// 创建调度器，onError不为空时在任务返回错误时调用
+func New(onError func(job Job, err error)) *Scheduler {
+	return &Scheduler{
+		entries: make(map[*Entry]bool),
+		onError: onError,
+	}
+}
+
+// 启动调度器，启动前添加的任务开始执行
+func (p *Scheduler) Start() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.started {
+		return
+	}
+	p.started = true
+
+	for e := range p.entries {
+		go p.run(e)
+	}
+}
+
+// 停止所有任务
+func (p *Scheduler) Stop() {
+	p.Lock()
+	entries := p.entries
+	p.entries = make(map[*Entry]bool)
+	p.started = false
+	p.Unlock()
+
+	for e := range entries {
+		e.Cancel()
+	}
+}
+
+// 添加周期任务，第一次在interval后执行
+func (p *Scheduler) Add(job Job, interval time.Duration, mode Mode) *Entry {
+	return p.AddAt(job, time.Now().Add(interval), interval, mode)
+}
+
+// 添加周期任务，第一次在first执行
+func (p *Scheduler) AddAt(job Job, first time.Time, interval time.Duration, mode Mode) *Entry {
+	if interval <= 0 {
+		panic(fmt.Sprintf("scheduler: invalid interval %s", interval))
+	}
+
+	return p.add(&Entry{
+		job:      job,
+		first:    first,
+		base:     first.Add(-interval),
+		interval: interval,
+		mode:     mode,
+		stop:     make(chan struct{}),
+		reset:    make(chan struct{}, 1),
+	})
+}
+
+// 添加一次性任务，在delay后执行
+func (p *Scheduler) Once(job Job, delay time.Duration) *Entry {
+	return p.add(&Entry{
+		job:   job,
+		first: time.Now().Add(delay),
+		once:  true,
+		stop:  make(chan struct{}),
+		reset: make(chan struct{}, 1),
+	})
+}
+
+func (p *Scheduler) add(e *Entry) *Entry {
+	p.Lock()
+	defer p.Unlock()
+
+	p.entries[e] = true
+	if p.started {
+		go p.run(e)
+	}
+	return e
+}
+
+func (p *Scheduler) remove(e *Entry) {
+	p.Lock()
+	delete(p.entries, e)
+	p.Unlock()
+}
+
+// 执行任务，FixedRate按计划时间计算下一次执行时间，避免误差累积
+func (p *Scheduler) run(e *Entry) {
+	defer p.remove(e)
+
+	var (
+		next = e.first
+		// 计算下一次执行时间的基准，修改间隔时按新的间隔从基准重新计算
+		base = e.base
+		tm   = time.NewTimer(time.Until(next))
+	)
+	defer tm.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.reset:
+			interval, _ := e.schedule()
+			next = base.Add(interval)
+			if !tm.Stop() {
+				select {
+				case <-tm.C:
+				default:
+				}
+			}
+			tm.Reset(time.Until(next))
+			continue
+		case <-tm.C:
+		}
+
+		if err := e.job.Run(); err != nil && p.onError != nil {
+			p.onError(e.job, err)
+		}
+
+		if e.once {
+			e.Cancel()
+			return
+		}
+
+		interval, mode := e.schedule()
+		now := time.Now()
+		if mode == FixedDelay {
+			base = now
+			next = now.Add(interval)
+		} else {
+			base = next
+			next = next.Add(interval)
+			if next.Before(now) {
+				// 执行落后时跳到下一个未到的计划时间
+				next = next.Add(now.Sub(next).Truncate(interval) + interval)
+				base = next.Add(-interval)
+			}
+		}
+		tm.Reset(time.Until(next))
+	}
+}
+
+func (e *Entry) schedule() (time.Duration, Mode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.interval, e.mode
+}
+
+// 修改周期任务的间隔和执行方式，下一次执行时间按新的间隔从上一次执行重新计算，
+// 已经错过时立即执行
+func (e *Entry) Reschedule(interval time.Duration, mode Mode) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("scheduler: invalid interval %s", interval))
+	}
+	if e.once {
+		return
+	}
+
+	e.mu.Lock()
+	e.interval = interval
+	e.mode = mode
+	e.mu.Unlock()
+
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+}
+
+// 取消任务
+func (e *Entry) Cancel() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+		e.job.Stop()
+	})
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次执行开始时间的任务，每次执行耗时cost
+type recordJob struct {
+	sync.Mutex
+	cost    time.Duration
+	starts  []time.Time
+	stopped bool
+}
+
+func (p *recordJob) Run() error {
+	p.Lock()
+	p.starts = append(p.starts, time.Now())
+	p.Unlock()
+	time.Sleep(p.cost)
+	return nil
+}
+
+func (p *recordJob) Stop() error {
+	p.Lock()
+	p.stopped = true
+	p.Unlock()
+	return nil
+}
+
+func (p *recordJob) runs() []time.Time {
+	p.Lock()
+	defer p.Unlock()
+	return append([]time.Time(nil), p.starts...)
+}
+
+const (
+	testInterval  = 50 * time.Millisecond
+	testTolerance = 20 * time.Millisecond
+)
+
+func runFor(t *testing.T, job *recordJob, mode Mode, d time.Duration) (time.Time, []time.Time) {
+	t.Helper()
+
+	s := New(nil)
+	s.Start()
+	defer s.Stop()
+
+	first := time.Now().Add(testInterval)
+	s.AddAt(job, first, testInterval, mode)
+	time.Sleep(d)
+	return first, job.runs()
+}
+
+func TestFixedRateNoDrift(t *testing.T) {
+	job := &recordJob{cost: 30 * time.Millisecond}
+	first, starts := runFor(t, job, FixedRate, 8*testInterval)
+
+	if len(starts) < 5 {
+		t.Fatalf("执行%d次, 至少应执行5次", len(starts))
+	}
+	// 每次都在计划时间执行，执行耗时不累积到下一次
+	for i, st := range starts {
+		offset := st.Sub(first.Add(time.Duration(i) * testInterval))
+		if offset < 0 || offset > testTolerance {
+			t.Errorf("第%d次执行偏离计划时间%s", i, offset)
+		}
+	}
+}
+
+func TestFixedRateSkipMissed(t *testing.T) {
+	job := &recordJob{cost: 120 * time.Millisecond}
+	first, starts := runFor(t, job, FixedRate, 10*testInterval)
+
+	if len(starts) < 3 {
+		t.Fatalf("执行%d次, 至少应执行3次", len(starts))
+	}
+	// 落后时跳到下一个计划时间，不连续补执行
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 3*testInterval-testTolerance {
+			t.Errorf("第%d次执行间隔%s, 应跳过错过的执行", i, gap)
+		}
+		offset := starts[i].Sub(first) % testInterval
+		if offset > testTolerance {
+			t.Errorf("第%d次执行偏离计划时间%s", i, offset)
+		}
+	}
+}
+
+func TestFixedDelay(t *testing.T) {
+	job := &recordJob{cost: 30 * time.Millisecond}
+	_, starts := runFor(t, job, FixedDelay, 8*testInterval)
+
+	if len(starts) < 3 {
+		t.Fatalf("执行%d次, 至少应执行3次", len(starts))
+	}
+	// 上一次执行结束后等待间隔再执行
+	for i := 1; i < len(starts); i++ {
+		gap := starts[i].Sub(starts[i-1])
+		if gap < job.cost+testInterval || gap > job.cost+testInterval+testTolerance {
+			t.Errorf("第%d次执行间隔%s, 应为%s", i, gap, job.cost+testInterval)
+		}
+	}
+}
+
+func TestOnce(t *testing.T) {
+	s := New(nil)
+	s.Start()
+	defer s.Stop()
+
+	job := new(recordJob)
+	s.Once(job, 10*time.Millisecond)
+	time.Sleep(5 * testInterval)
+
+	if n := len(job.runs()); n != 1 {
+		t.Fatalf("一次性任务执行%d次", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := New(nil)
+	s.Start()
+	defer s.Stop()
+
+	job := new(recordJob)
+	e := s.Add(job, testInterval, FixedRate)
+	time.Sleep(testInterval + testTolerance)
+	e.Cancel()
+	n := len(job.runs())
+	time.Sleep(3 * testInterval)
+
+	if m := len(job.runs()); m != n {
+		t.Fatalf("取消后仍然执行了%d次", m-n)
+	}
+	if !job.stopped {
+		t.Fatalf("取消任务时没有调用Stop")
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	s := New(nil)
+	s.Start()
+	defer s.Stop()
+
+	job := new(recordJob)
+	e := s.Add(job, time.Hour, FixedRate)
+	e.Reschedule(testInterval, FixedDelay)
+	time.Sleep(4*testInterval + testTolerance)
+
+	// 修改后按上一次执行重新计算，没有执行过时从添加时开始计算
+	if n := len(job.runs()); n < 3 {
+		t.Fatalf("修改间隔后执行%d次, 至少应执行3次", n)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for s, want := range map[string]Mode{
+		"":            FixedRate,
+		"fixed_rate":  FixedRate,
+		"FIXED_DELAY": FixedDelay,
+	} {
+		m, err := ParseMode(s)
+		if err != nil || m != want {
+			t.Errorf("ParseMode(%q) = %s, %v, 应为%s", s, m, err, want)
+		}
+	}
+
+	if _, err := ParseMode("cron"); err == nil {
+		t.Errorf("ParseMode(%q) 应返回错误", "cron")
+	}
+}
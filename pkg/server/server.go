@@ -0,0 +1,81 @@
+package server
+
+import (
+	"b1Exchange/pkg/log"
+	"b1Exchange/pkg/model"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// 不经过http服务认证的路径前缀，控制接口使用单独的control_token认证
+var authExemptPrefixes = []string{
+	"/api/v1/control/",
+}
+
+// 根据配置启动http服务，disable为true时直接返回
+func Serve(cfg *model.HTTPConfig, handler http.Handler) error {
+	if cfg.Disable {
+		log.Logger.Infof("http服务已禁用")
+		return nil
+	}
+
+	var srv = &http.Server{
+		Addr:    cfg.Listen,
+		Handler: authHandler(cfg, handler),
+	}
+
+	if cfg.TLSCertFile != "" {
+		log.Logger.Infof("启动https服务, 监听地址: %s", cfg.Listen)
+		return srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+
+	log.Logger.Infof("启动http服务, 监听地址: %s", cfg.Listen)
+	return srv.ListenAndServe()
+}
+
+// 按配置的认证方式检查请求
+func authHandler(cfg *model.HTTPConfig, next http.Handler) http.Handler {
+	if cfg.Auth == model.HTTPAuthNone {
+		return next
+	}
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		for _, prefix := range authExemptPrefixes {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				next.ServeHTTP(resp, req)
+				return
+			}
+		}
+
+		if !authorized(cfg, req) {
+			if cfg.Auth == model.HTTPAuthBasic {
+				resp.Header().Set("WWW-Authenticate", `Basic realm="b1Exchange"`)
+			}
+			http.Error(resp, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+func authorized(cfg *model.HTTPConfig, req *http.Request) bool {
+	switch cfg.Auth {
+	case model.HTTPAuthBasic:
+		username, password, ok := req.BasicAuth()
+		return ok && equal(username, cfg.Username) && equal(password, cfg.Password)
+	case model.HTTPAuthToken:
+		token := req.Header.Get("Authorization")
+		if !strings.HasPrefix(token, "Bearer ") {
+			return false
+		}
+		return equal(strings.TrimPrefix(token, "Bearer "), cfg.Token)
+	}
+
+	return false
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
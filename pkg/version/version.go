@@ -0,0 +1,4 @@
+package version
+
+// 版本号，编译时通过 -ldflags "-X b1Exchange/pkg/version.Version=x.y.z" 设置
+var Version = "dev"